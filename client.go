@@ -1,11 +1,11 @@
 package websocket_packet
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"github.com/qdmc/websocket_packet/frame"
 	"github.com/qdmc/websocket_packet/session"
+	"io"
 	"net"
 	"net/http"
 
@@ -19,6 +19,30 @@ type Session = session.WebsocketSessionInterface
 // SessionDb      链接信息
 type SessionDb = session.ConnectionDatabase
 
+// RateLimit        接收消息的速率限制
+type RateLimit = session.RateLimit
+
+// MessageLimits    接收消息的大小限制
+type MessageLimits = session.MessageLimits
+
+// IdlePolicy       空闲超时策略
+type IdlePolicy = session.IdlePolicy
+
+// Heartbeat        心跳配置
+type Heartbeat = session.Heartbeat
+
+// HeartbeatStats   心跳统计
+type HeartbeatStats = session.HeartbeatStats
+
+// HandshakeInfo    握手信息的只读快照
+type HandshakeInfo = session.HandshakeInfo
+
+// WriteCoalescing  写入合并配置
+type WriteCoalescing = session.WriteCoalescing
+
+// CodecOptions     编解码器配置
+type CodecOptions = frame.CodecOptions
+
 // ClientStatus     客户端状态
 type ClientStatus = session.Status
 
@@ -33,6 +57,15 @@ ClientOptions               客户端配置
   - RequestTime             发送请求的最大时长(秒),默认:10;最小:3;最大:60
   - PingTime                自动发送pingFrame的时间(秒)配置, <1:关闭(默认值); 1~~25:都会配置为25秒; >120:都会配置为120秒
   - IsStatistics            是否开启流量统计,默认为false
+  - MessageLimits           接收消息的大小限制,为空时使用 Codec 的限制
+  - Heartbeat               心跳配置,不为空时忽略 PingTime;连续丢失pong超过 MaxMissed 时断开并重链
+  - PingCallback            收到ping帧后的回调,ok为true时以reply回复pong帧,为false时不回复;为空时以相同的负载回复pong帧
+  - PongCallback            收到pong帧后的回调
+  - PingPayload             心跳ping帧的负载,为空或返回nil时使用默认负载
+  - Codec                   编解码器配置(帧与消息的大小限制,分包大小,严格校验),Role 固定为 frame.RoleClient
+  - StreamCallback          以流的方式接收消息的回调,不为空时不再执行 MessageCallback
+  - PullMode                是否以 NextReader 拉取消息,为true时不再执行 MessageCallback
+  - WriteCoalescing         写入合并,为空时不合并
 */
 type ClientOptions struct {
 	ReConnectMaxNum    int
@@ -44,6 +77,15 @@ type ClientOptions struct {
 	RequestTime        int64
 	PingTime           int64
 	IsStatistics       bool
+	MessageLimits      *MessageLimits
+	Heartbeat          *Heartbeat
+	PingCallback       func(payload []byte) (reply []byte, ok bool)
+	PongCallback       func(payload []byte)
+	PingPayload        func() []byte
+	Codec              *CodecOptions
+	StreamCallback     func(opcode byte, r io.Reader)
+	PullMode           bool
+	WriteCoalescing    *WriteCoalescing
 }
 
 // NewClientOption      生成一个新的客户端配置
@@ -161,6 +203,24 @@ func (c *Client) SendMessage(frameType byte, payload []byte, keys ...uint32) (in
 	}
 }
 
+// NextWriter          以流的方式发送一个分包消息到服务端,opcode:1:text;2:binary;Close 时发送最后一个分包
+func (c *Client) NextWriter(opcode byte) (io.WriteCloser, error) {
+	if c.s != nil {
+		return c.s.NextWriter(opcode)
+	} else {
+		return nil, errors.New("not dial to server")
+	}
+}
+
+// NextReader          拉取模式(ClientOptions.PullMode)下,等待并返回下一个消息的opcode及读取器
+func (c *Client) NextReader() (byte, io.Reader, error) {
+	if c.s != nil {
+		return c.s.NextReader()
+	} else {
+		return 0, nil, errors.New("not dial to server")
+	}
+}
+
 // Disconnect          断开与服务器链接
 func (c *Client) Disconnect() {
 	if c.s != nil {
@@ -168,6 +228,14 @@ func (c *Client) Disconnect() {
 	}
 }
 
+// GetHeartbeatStats   返回当前链接的心跳统计
+func (c *Client) GetHeartbeatStats() HeartbeatStats {
+	if c.s != nil {
+		return c.s.GetHeartbeatStats()
+	}
+	return HeartbeatStats{}
+}
+
 // connCb        链接到服务端回调方法
 func (c *Client) connCb() {
 	if c.opt != nil && c.opt.ConnectedCallback != nil {
@@ -241,91 +309,73 @@ func (c *Client) dialToServer() error {
 	if err != nil {
 		return err
 	}
-	req := c.makeRequest()
-	err = req.Write(conn)
+	wsConn, resp, err := clientHandshake(conn, c.url, c.opt.RequestHeader, time.Duration(c.opt.RequestTime)*time.Second)
 	if err != nil {
+		conn.Close()
+		c.status = session.ClientConnectFailed
 		return err
 	}
-	bufRead := bufio.NewReaderSize(conn, 4096)
-	bufRead.Reset(conn)
-	defer func() {
-		if err != nil {
-			conn.Close()
-			c.status = session.ClientConnectFailed
-		} else {
-			c.status = session.Connected
+
+	go c.connCb()
+	var onPing session.PingCallBackHandle
+	var onPong session.PongCallBackHandle
+	var pingPayload session.PingPayloadHandle
+	if f := c.opt.PingCallback; f != nil {
+		onPing = func(id int64, payload []byte) ([]byte, bool) {
+			return f(payload)
 		}
-	}()
-	resp, err := http.ReadResponse(bufRead, req)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != http.StatusSwitchingProtocols {
-		return errors.New("response statusCode is not 101")
 	}
-	if !checkHttpHeaderKeyVale(resp.Header, "Upgrade", "websocket") {
-		return errors.New("response header.Upgrade is not websocket")
+	if f := c.opt.PongCallback; f != nil {
+		onPong = func(id int64, payload []byte) {
+			f(payload)
+		}
 	}
-	if !checkHttpHeaderKeyVale(resp.Header, "Connection", "upgrade") {
-		return errors.New("response header.Connection is not upgrade")
+	var streamCb session.StreamCallBackHandle
+	if f := c.opt.StreamCallback; f != nil {
+		streamCb = func(id int64, opcode byte, r io.Reader) {
+			f(opcode, r)
+		}
 	}
-	if resp.Header.Get("Sec-Websocket-Accept") != computeAcceptKey(req.Header.Get("Sec-WebSocket-Key")) {
-		return errors.New("response header.Sec-Websocket-Accept is error")
+	if f := c.opt.PingPayload; f != nil {
+		pingPayload = func(id int64) []byte {
+			return f()
+		}
 	}
-	err = conn.SetDeadline(time.Time{})
-	if err != nil {
-		return err
+	var codecOptions *frame.CodecOptions
+	if c.opt.Codec != nil {
+		o := *c.opt.Codec
+		o.Role = frame.RoleClient
+		codecOptions = &o
 	}
-
-	go c.connCb()
-	c.s = session.NewSession(conn, false, &session.ConfigureSession{
+	c.s = session.NewSession(wsConn, false, &session.ConfigureSession{
 		ConnectedCallBackHandle: nil,
 		DisConnectCallBack:      c.disConnCb,
 		FrameCallBackHandle:     c.msgCb,
 		IsStatistics:            c.opt.IsStatistics,
 		AutoPingTicker:          c.opt.PingTime,
+		Handshake:               newClientHandshakeInfo(c.url, resp),
+		MessageLimits:           c.opt.MessageLimits,
+		Heartbeat:               c.opt.Heartbeat,
+		PingCallBackHandle:      onPing,
+		PongCallBackHandle:      onPong,
+		PingPayloadHandle:       pingPayload,
+		Codec:                   codecOptions,
+		StreamCallBackHandle:    streamCb,
+		PullMode:                c.opt.PullMode,
+		WriteCoalescing:         c.opt.WriteCoalescing,
 	})
+	// 在开始读取之前变更状态,读取中断开时的回调会再次变更状态
+	c.status = session.Connected
 	go c.s.DoConnect()
 	return nil
 }
 
 // parseUrl      解析url
 func (c *Client) parseUrl(urlStr string) error {
-	u, err := url.Parse(urlStr)
+	u, err := parseWebsocketUrl(urlStr)
 	if err != nil {
 		return err
 	}
-	var scheme string
-	if u.Scheme == "ws" {
-		scheme = "http"
-	} else if u.Scheme == "wss" {
-		scheme = "https"
-	} else {
-		return errors.New("scheme must be ws or wss")
-	}
-	u.Scheme = scheme
 	c.url = u
 	return nil
 }
-func (c *Client) makeRequest() *http.Request {
-	req := &http.Request{
-		Method:     http.MethodGet,
-		URL:        c.url,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Host:       c.url.Host,
-	}
-	key, _ := generateChallengeKey()
-	req.Header["Upgrade"] = []string{"websocket"}
-	req.Header["Connection"] = []string{"Upgrade"}
-	req.Header.Add("Sec-WebSocket-Key", key)
-	req.Header["Sec-WebSocket-Version"] = []string{"13"}
-	if c.opt != nil && c.opt.RequestHeader != nil {
-		for headKey, headValue := range c.opt.RequestHeader {
-			req.Header[headKey] = headValue
-		}
-	}
-	return req
-}
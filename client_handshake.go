@@ -0,0 +1,165 @@
+package websocket_packet
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/qdmc/websocket_packet/session"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultHandshakeTimeout     客户端握手默认的最长时间
+const defaultHandshakeTimeout = 10 * time.Second
+
+/*
+ClientHandshakeOptions      ClientHandshake 的配置
+  - Header                  请求时携带额外的请求头
+  - Subprotocols            请求的子协议,按优先级排序
+  - Timeout                 握手(发送请求到读取响应)的最长时间,<=0:10秒
+  - Session                 Session 的配置(回调,心跳,限制,编解码器等),为空时使用默认配置;Handshake 为空时使用本次握手的信息
+*/
+type ClientHandshakeOptions struct {
+	Header       http.Header
+	Subprotocols []string
+	Timeout      time.Duration
+	Session      *session.ConfigureSession
+}
+
+/*
+ClientHandshake             在已建立的链接(如:SSH端口转发,自己终止的TLS)上执行客户端握手,不执行拨号
+  - urlStr                  ws:// 或 wss:// 的url,Host 与路径用于握手请求;wss 时 conn 应是已完成TLS握手的链接
+  - 读取101响应时已缓冲的数据(服务端在101之后立即发送的帧)不会丢失
+  - 响应不是101,或服务端选择了客户端未请求的子协议时,返回响应(可以读取Body)及错误
+  - 失败时不关闭conn,由调用方处理
+  - 返回的 Session 由调用方管理,需要调用方执行 DoConnect(一般在新的goroutine中)
+*/
+func ClientHandshake(conn net.Conn, urlStr string, opts ClientHandshakeOptions) (Session, *http.Response, error) {
+	u, err := parseWebsocketUrl(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	for key, values := range opts.Header {
+		header[key] = values
+	}
+	if len(opts.Subprotocols) > 0 {
+		header.Set("Sec-WebSocket-Protocol", strings.Join(opts.Subprotocols, ", "))
+	}
+	conn, resp, err := clientHandshake(conn, u, header, opts.Timeout)
+	if err != nil {
+		return nil, resp, err
+	}
+	conf := session.ConfigureSession{}
+	if opts.Session != nil {
+		conf = *opts.Session
+	}
+	if conf.Handshake == nil {
+		conf.Handshake = newClientHandshakeInfo(u, resp)
+	}
+	return session.NewSession(conn, false, &conf), resp, nil
+}
+
+/*
+clientHandshake             发送握手请求并校验101响应,成功时返回读取了缓冲数据的conn
+  - 读取响应的 bufio.Reader 中,101之后已缓冲的数据在返回的conn中先被读取
+*/
+func clientHandshake(conn net.Conn, u *url.URL, header http.Header, timeout time.Duration) (net.Conn, *http.Response, error) {
+	if timeout <= 0 {
+		timeout = defaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, nil, err
+	}
+	req := makeHandshakeRequest(u, header)
+	if err := req.Write(conn); err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReaderSize(conn, 4096)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = checkHandshakeResponse(req, resp); err != nil {
+		return nil, resp, err
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		return nil, resp, err
+	}
+	return withBuffered(conn, br), resp, nil
+}
+
+// parseWebsocketUrl      解析url,ws,wss 转换为 http,https
+func parseWebsocketUrl(urlStr string) (*url.URL, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, errors.New("scheme must be ws or wss")
+	}
+	return u, nil
+}
+
+// makeHandshakeRequest   生成握手请求,header 会覆盖默认的请求头
+func makeHandshakeRequest(u *url.URL, header http.Header) *http.Request {
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	key, _ := generateChallengeKey()
+	req.Header["Upgrade"] = []string{"websocket"}
+	req.Header["Connection"] = []string{"Upgrade"}
+	req.Header.Add("Sec-WebSocket-Key", key)
+	req.Header["Sec-WebSocket-Version"] = []string{"13"}
+	for headKey, headValue := range header {
+		req.Header[headKey] = headValue
+	}
+	return req
+}
+
+// checkHandshakeResponse 校验服务端的101响应
+func checkHandshakeResponse(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return errors.New("response statusCode is not 101")
+	}
+	if !checkHttpHeaderKeyVale(resp.Header, "Upgrade", "websocket") {
+		return errors.New("response header.Upgrade is not websocket")
+	}
+	if !checkHttpHeaderKeyVale(resp.Header, "Connection", "upgrade") {
+		return errors.New("response header.Connection is not upgrade")
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != computeAcceptKey(req.Header.Get("Sec-WebSocket-Key")) {
+		return errors.New("response header.Sec-Websocket-Accept is error")
+	}
+	// 服务端只能选择客户端请求的一个子协议(RFC 6455 4.1)
+	if protocols := resp.Header.Values("Sec-Websocket-Protocol"); len(protocols) > 1 {
+		return errors.New("response header.Sec-Websocket-Protocol has multiple values")
+	} else if len(protocols) == 1 && selectSubprotocol(req, protocols) != protocols[0] {
+		return errors.New(fmt.Sprintf("response header.Sec-Websocket-Protocol(%s) was not offered", protocols[0]))
+	}
+	return nil
+}
+
+// newClientHandshakeInfo 客户端的握手信息
+func newClientHandshakeInfo(u *url.URL, resp *http.Response) *session.HandshakeInfo {
+	return &session.HandshakeInfo{
+		URL:         u,
+		Host:        u.Host,
+		Header:      resp.Header,
+		Subprotocol: resp.Header.Get("Sec-Websocket-Protocol"),
+	}
+}
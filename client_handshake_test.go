@@ -0,0 +1,108 @@
+package websocket_packet
+
+import (
+	"bufio"
+	"github.com/qdmc/websocket_packet/frame"
+	"github.com/qdmc/websocket_packet/session"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_ClientHandshake(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go func() {
+		req, err := http.ReadRequest(bufio.NewReader(serverConn))
+		if err != nil {
+			return
+		}
+		// 101与第一个帧一起发送,帧会被读取响应的 bufio.Reader 缓冲
+		bs := makeServerHandshakeBytes(req, "", nil)
+		f, _ := frame.NewTextFrame([]byte("welcome"))
+		welcome, _ := f.ToBytes()
+		serverConn.Write(append(bs, welcome...))
+	}()
+	received := make(chan string, 1)
+	sess, resp, err := ClientHandshake(clientConn, "ws://example.com/ws", ClientHandshakeOptions{
+		Timeout: time.Second,
+		Session: &session.ConfigureSession{
+			FrameCallBackHandle: func(id int64, t byte, bs []byte) {
+				received <- string(bs)
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal("handshakeErr: ", err.Error())
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("status: ", resp.StatusCode)
+	}
+	go sess.DoConnect()
+	defer sess.DisConnect()
+	select {
+	case msg := <-received:
+		if msg != "welcome" {
+			t.Fatal("message: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("buffered frame lost")
+	}
+}
+
+func Test_ClientHandshakeSubprotocol(t *testing.T) {
+	u, _ := parseWebsocketUrl("ws://example.com/ws")
+	cases := []struct {
+		name    string
+		offered string
+		reply   []string
+		ok      bool
+	}{
+		{"none", "", nil, true},
+		{"offered", "chat, superchat", []string{"superchat"}, true},
+		{"not selected", "chat", nil, true},
+		{"not offered", "chat", []string{"other"}, false},
+		{"nothing offered", "", []string{"chat"}, false},
+		{"multiple values", "chat, superchat", []string{"chat", "superchat"}, false},
+		{"list value", "chat, superchat", []string{"chat, superchat"}, false},
+	}
+	for _, c := range cases {
+		header := http.Header{}
+		if c.offered != "" {
+			header.Set("Sec-WebSocket-Protocol", c.offered)
+		}
+		req := makeHandshakeRequest(u, header)
+		resp := &http.Response{StatusCode: http.StatusSwitchingProtocols, Header: http.Header{
+			"Upgrade":              {"websocket"},
+			"Connection":           {"Upgrade"},
+			"Sec-Websocket-Accept": {computeAcceptKey(req.Header.Get("Sec-WebSocket-Key"))},
+		}}
+		for _, p := range c.reply {
+			resp.Header.Add("Sec-WebSocket-Protocol", p)
+		}
+		if err := checkHandshakeResponse(req, resp); (err == nil) != c.ok {
+			t.Fatalf("%s: err %v", c.name, err)
+		}
+	}
+}
+
+func Test_ClientHandshakeRejectSubprotocol(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go func() {
+		req, err := http.ReadRequest(bufio.NewReader(serverConn))
+		if err != nil {
+			return
+		}
+		serverConn.Write(makeServerHandshakeBytes(req, "other", nil))
+	}()
+	if _, _, err := ClientHandshake(clientConn, "ws://example.com/ws", ClientHandshakeOptions{
+		Subprotocols: []string{"chat"},
+		Timeout:      time.Second,
+	}); err == nil {
+		t.Fatal("subprotocol not offered should fail")
+	}
+}
@@ -0,0 +1,114 @@
+package websocket_packet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ipNets      CIDR列表
+type ipNets []*net.IPNet
+
+// parseIPNets    解析CIDR列表,单个ip视为/32或/128
+func parseIPNets(cidrs ...string) (ipNets, error) {
+	var list ipNets
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("bad ip(%s)", cidr))
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ipNet)
+	}
+	return list, nil
+}
+
+// contains      ip是否在CIDR列表中
+func (ns ipNets) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range ns {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedProxies      受信任的代理,只有来自受信任代理的请求才会使用 X-Forwarded-For 与 X-Real-IP
+type trustedProxies struct {
+	mu   sync.RWMutex
+	nets ipNets
+}
+
+func (t *trustedProxies) set(cidrs ...string) error {
+	nets, err := parseIPNets(cidrs...)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nets = nets
+	return nil
+}
+
+func (t *trustedProxies) isTrusted(ip net.IP) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.nets.contains(ip)
+}
+
+// remoteIP         返回请求的直连ip
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// clientIP         返回请求的客户端ip:直连ip来自受信任的代理时,从右向左取 X-Forwarded-For 中第一个不受信任的ip,或者 X-Real-IP
+func (t *trustedProxies) clientIP(req *http.Request) net.IP {
+	ip := remoteIP(req)
+	if !t.isTrusted(ip) {
+		return ip
+	}
+	var forwarded []string
+	for _, val := range req.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(val, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		fip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if fip == nil {
+			break
+		}
+		ip = fip
+		if !t.isTrusted(fip) {
+			return fip
+		}
+	}
+	if len(forwarded) == 0 {
+		if rip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); rip != nil {
+			return rip
+		}
+	}
+	return ip
+}
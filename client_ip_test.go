@@ -0,0 +1,60 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_ClientIP(t *testing.T) {
+	proxies := &trustedProxies{}
+	if err := proxies.set("10.0.0.0/8", "192.168.1.1"); err != nil {
+		t.Fatal("setErr: ", err.Error())
+	}
+	cases := []struct {
+		name    string
+		remote  string
+		forward []string
+		realIP  string
+		want    string
+	}{
+		{"untrusted remote ignores headers", "1.2.3.4:80", []string{"5.5.5.5"}, "6.6.6.6", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:80", []string{"5.5.5.5"}, "", "5.5.5.5"},
+		{"trusted proxy chain", "10.0.0.1:80", []string{"5.5.5.5, 10.0.0.2", "192.168.1.1"}, "", "5.5.5.5"},
+		{"spoofed left entries", "10.0.0.1:80", []string{"9.9.9.9, 5.5.5.5"}, "", "5.5.5.5"},
+		{"spoofed trusted entry", "10.0.0.1:80", []string{"10.0.0.9, 5.5.5.5"}, "", "5.5.5.5"},
+		{"all trusted", "10.0.0.1:80", []string{"10.0.0.2, 10.0.0.3"}, "", "10.0.0.2"},
+		{"bad entry stops", "10.0.0.1:80", []string{"5.5.5.5, garbage, 10.0.0.2"}, "", "10.0.0.2"},
+		{"bad last entry", "10.0.0.1:80", []string{"5.5.5.5, garbage"}, "", "10.0.0.1"},
+		{"real ip", "10.0.0.1:80", nil, "5.5.5.5", "5.5.5.5"},
+		{"forwarded before real ip", "10.0.0.1:80", []string{"5.5.5.5"}, "6.6.6.6", "5.5.5.5"},
+		{"bad real ip", "10.0.0.1:80", nil, "garbage", "10.0.0.1"},
+		{"ipv6", "[fe80::1]:80", []string{"5.5.5.5"}, "", "fe80::1"},
+		{"no port", "1.2.3.4", nil, "", "1.2.3.4"},
+	}
+	for _, c := range cases {
+		req := &http.Request{RemoteAddr: c.remote, Header: http.Header{}}
+		for _, v := range c.forward {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if c.realIP != "" {
+			req.Header.Set("X-Real-IP", c.realIP)
+		}
+		if ip := proxies.clientIP(req).String(); ip != c.want {
+			t.Fatalf("%s: got %s, want %s", c.name, ip, c.want)
+		}
+	}
+	// 重新加载后不再信任原来的代理
+	if err := proxies.set("172.16.0.0/12"); err != nil {
+		t.Fatal("setErr: ", err.Error())
+	}
+	req := &http.Request{RemoteAddr: "10.0.0.1:80", Header: http.Header{"X-Forwarded-For": {"5.5.5.5"}}}
+	if ip := proxies.clientIP(req).String(); ip != "10.0.0.1" {
+		t.Fatal("after reload: ", ip)
+	}
+	if err := proxies.set("bad"); err == nil {
+		t.Fatal("bad cidr should fail")
+	}
+	if !proxies.isTrusted(remoteIP(&http.Request{RemoteAddr: "172.16.0.1:80"})) {
+		t.Fatal("failed set should keep the previous proxies")
+	}
+}
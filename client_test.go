@@ -0,0 +1,58 @@
+package websocket_packet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ClientControlCallbacks(t *testing.T) {
+	serverPongs := make(chan []byte, 16)
+	server, ts, ids := newTestServer(t, &CallbackHandles{
+		PongCallBackHandle: func(id int64, payload []byte) {
+			serverPongs <- append([]byte(nil), payload...)
+		},
+	})
+	clientPings := make(chan []byte, 16)
+	clientPongs := make(chan []byte, 16)
+	opt := NewClientOption().SetReConnect(-1, 1)
+	opt.Heartbeat = &Heartbeat{Interval: 50 * time.Millisecond}
+	opt.PingPayload = func() []byte { return bytes.Repeat([]byte("c"), 130) }
+	opt.PingCallback = func(payload []byte) ([]byte, bool) {
+		clientPings <- append([]byte(nil), payload...)
+		return nil, false
+	}
+	opt.PongCallback = func(payload []byte) {
+		clientPongs <- append([]byte(nil), payload...)
+	}
+	c := NewClient(opt)
+	if err := c.Dial("ws" + strings.TrimPrefix(ts.URL, "http")); err != nil {
+		t.Fatal("dialErr: ", err.Error())
+	}
+	t.Cleanup(c.Disconnect)
+	id := waitTestId(t, ids)
+	// 客户端心跳的负载被截断为125字节,服务端以相同的负载回复
+	if p := waitBytes(t, clientPongs, "client pong"); !bytes.Equal(p, bytes.Repeat([]byte("c"), 125)) {
+		t.Fatal("client pong: ", len(p))
+	}
+	// 客户端的 PingCallback 收到服务端的ping,返回false时不回复
+	sess, err := server.GetSessionOnce(id)
+	if err != nil {
+		t.Fatal("getSessionErr: ", err.Error())
+	}
+	if _, err = sess.Write(9, []byte("server-ping")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	if p := waitBytes(t, clientPings, "client ping callback"); string(p) != "server-ping" {
+		t.Fatal("client ping: ", string(p))
+	}
+	select {
+	case p := <-serverPongs:
+		t.Fatal("suppressed pong received: ", string(p))
+	case <-time.After(150 * time.Millisecond):
+	}
+	if c.GetHeartbeatStats().Received == 0 {
+		t.Fatalf("heartbeat stats: %+v", c.GetHeartbeatStats())
+	}
+}
@@ -75,6 +75,29 @@ func ExampleNewServerHandle() {
 	http.ListenAndServe(":8080", nil)
 }
 
+func ExampleUpgrade() {
+	http.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+		var sess Session
+		sess, err := Upgrade(w, req, UpgradeOptions{
+			Subprotocols: []string{"chat"},
+			Session: &session.ConfigureSession{
+				FrameCallBackHandle: func(id int64, t byte, bs []byte) {
+					// echo
+					sess.Write(t, bs)
+				},
+				Heartbeat: &Heartbeat{Interval: 30 * time.Second, MaxMissed: 2},
+			},
+		})
+		if err != nil {
+			// 已回复错误
+			return
+		}
+		// Session 由调用方管理,DoConnect 阻塞到断开
+		sess.DoConnect()
+	})
+	http.ListenAndServe(":8080", nil)
+}
+
 var server ServerHandlerInterface
 
 func Test_server(t *testing.T) {
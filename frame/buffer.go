@@ -0,0 +1,53 @@
+package frame
+
+import "sync"
+
+// bufferClasses      负载缓冲池的容量分级,超过最大分级的负载不使用缓冲池
+var bufferClasses = [...]int{512, 4 << 10, 32 << 10, 256 << 10, 1 << 20}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+func init() {
+	for i := range bufferPools {
+		size := bufferClasses[i]
+		bufferPools[i].New = func() interface{} {
+			bs := make([]byte, size)
+			return &bs
+		}
+	}
+}
+
+// bufferClass        返回容纳n字节的分级,没有合适的分级时返回-1
+func bufferClass(n int) int {
+	for i, size := range bufferClasses {
+		if n <= size {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetBuffer          从缓冲池获取一个长度为n的缓冲区,用完后可以调用 PutBuffer 归还
+func GetBuffer(n int) []byte {
+	i := bufferClass(n)
+	if i < 0 {
+		return make([]byte, n)
+	}
+	bs := bufferPools[i].Get().(*[]byte)
+	return (*bs)[:n]
+}
+
+/*
+PutBuffer             归还 GetBuffer 获取的缓冲区
+  - 归还后不能再使用该缓冲区,及其切片
+  - 容量不属于任何分级的缓冲区会被忽略,可以安全地传入任意切片
+*/
+func PutBuffer(bs []byte) {
+	c := cap(bs)
+	i := bufferClass(c)
+	if i < 0 || bufferClasses[i] != c {
+		return
+	}
+	bs = bs[:c]
+	bufferPools[i].Put(&bs)
+}
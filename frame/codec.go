@@ -3,6 +3,7 @@ package frame
 import (
 	"errors"
 	"io"
+	"net"
 )
 
 /*
@@ -11,53 +12,80 @@ CodecInterface    解码器通用接口
   - ReadBuffer(buf []byte)             读取缓存冲区的字节流,返回:帖列表,剩余字节,error
   - WriteFrame(*Frame, io.Writer)      一个frame帧写入Connection,
   - WriteBytes([]byte, io.Writer)      写入字节流
+  - Options()                          返回配置
+  - Check(f *Frame)                    校验一个读取到的帧
+  - EncodeFrame(f *Frame)              编码一个帧,客户端角色时自动添加掩码
+  - EncodeMessage(opcode, payload)     按分包大小编码一个消息
+  - EncodeFrameBuffers(f *Frame)       编码一个帧为 net.Buffers,没有掩码时不复制负载
+  - EncodeMessageBuffers(opcode, payload) 按分包大小编码一个消息为 net.Buffers,没有掩码时不复制负载
+  - NewReader(r io.Reader)             生成一个带缓冲的 Reader
+  - NewDecoder(frameHandle, messageHandle) 生成一个使用当前配置的 Decoder
 */
 type CodecInterface interface {
-	ReadOnce(r io.Reader) (*Frame, error)            // 阻塞模式下读取一个 Frame
-	ReadBuffer(buf []byte) ([]*Frame, []byte, error) // 读取缓存冲区的字节流
-	WriteFrame(*Frame, io.Writer) (int, error)       // 一个frame帧写入
-	WriteBytes([]byte, io.Writer) (int, error)       // 写入字节流
+	ReadOnce(r io.Reader) (*Frame, error)                                                              // 阻塞模式下读取一个 Frame
+	ReadBuffer(buf []byte) ([]*Frame, []byte, error)                                                   // 读取缓存冲区的字节流
+	WriteFrame(*Frame, io.Writer) (int, error)                                                         // 一个frame帧写入
+	WriteBytes([]byte, io.Writer) (int, error)                                                         // 写入字节流
+	Options() CodecOptions                                                                             // 返回配置
+	Check(f *Frame) CloseStatus                                                                        // 校验一个读取到的帧,返回非 CloseNormalClosure 时应断开
+	EncodeFrame(f *Frame) ([]byte, error)                                                              // 编码一个帧
+	EncodeMessage(opcode byte, payload []byte) ([]byte, error)                                         // 编码一个消息,数据帧按 FragmentSize 分包,控制帧的负载超过125字节时截断
+	EncodeFrameBuffers(f *Frame) (net.Buffers, error)                                                  // 编码一个帧为帧头与负载,用于向量写入
+	EncodeMessageBuffers(opcode byte, payload []byte) (net.Buffers, error)                             // 编码一个消息为帧头与负载的列表,用于向量写入
+	NewReader(r io.Reader) *Reader                                                                     // 生成一个带缓冲的 Reader
+	NewDecoder(frameHandle func(f *Frame) error, messageHandle func(byte, net.Buffers) error) *Decoder // 生成一个使用当前配置的 Decoder
 }
 
+// NewCodec          生成一个默认配置的解码器,等同于 NewCodecWithOptions(CodecOptions{})
 func NewCodec() CodecInterface {
-	return new(defaultCodec)
+	return NewCodecWithOptions(CodecOptions{})
 }
 
-type defaultCodec struct{}
-
-func (defaultCodec) ReadOnce(r io.Reader) (*Frame, error) {
+func (c *codec) ReadOnce(r io.Reader) (*Frame, error) {
 	f := new(Frame)
-	_, readStatus := f.read(r)
-
+	_, readStatus := f.readLimit(r, c.opt.MaxFrameSize)
+	if readStatus == CloseNormalClosure {
+		readStatus = c.Check(f)
+	}
 	return f, StatusToError(readStatus)
 }
 
-func (defaultCodec) ReadBuffer(bs []byte) ([]*Frame, []byte, error) {
+func (c *codec) ReadBuffer(bs []byte) ([]*Frame, []byte, error) {
 	list, lastBS, readStatus := ReadStreamBufferBytes(bs)
+	for _, f := range list {
+		if readStatus != CloseNormalClosure {
+			break
+		}
+		if f.PayloadLength > c.opt.MaxFrameSize {
+			readStatus = CloseMessageTooBig
+		} else {
+			readStatus = c.Check(f)
+		}
+	}
 	return list, lastBS, StatusToError(readStatus)
 }
-func (defaultCodec) WriteFrame(f *Frame, c io.Writer) (writeLen int, err error) {
+func (c *codec) WriteFrame(f *Frame, w io.Writer) (writeLen int, err error) {
 	if f == nil {
 		return writeLen, errors.New("frame is empty")
 	}
-	if c == nil {
+	if w == nil {
 		return writeLen, errors.New("connection is empty")
 	}
-	bs, err := f.ToBytes()
+	bs, err := c.EncodeFrame(f)
 	if err != nil {
 		return writeLen, err
 	}
-	writeLen, err = c.Write(bs)
+	writeLen, err = w.Write(bs)
 	return
 }
-func (defaultCodec) WriteBytes(bs []byte, c io.Writer) (writeLen int, err error) {
-	if c == nil {
+func (c *codec) WriteBytes(bs []byte, w io.Writer) (writeLen int, err error) {
+	if w == nil {
 		return writeLen, errors.New("connection is empty")
 	}
 	if bs == nil && len(bs) == 0 {
 		return writeLen, errors.New("frames bytes  is empty")
 	}
-	writeLen, err = c.Write(bs)
+	writeLen, err = w.Write(bs)
 	return
 }
 
@@ -84,6 +112,7 @@ const (
 	SessionClientReconnect CloseStatus = 3001 //  新增自定义状态:客户端重新链接
 	SessionConnected       CloseStatus = 3002 //  新增自定义状态:正常连接。
 	SessionConnectFailed   CloseStatus = 3003 //  新增自定义状态:链接失败
+	CloseIdleTimeout       CloseStatus = 3004 //  新增自定义状态:空闲超时
 )
 
 // StatusToError    状态转换成 error
@@ -99,6 +128,8 @@ func StatusToError(s CloseStatus) error {
 		return nil
 	case SessionConnectFailed:
 		return errors.New("3003: client dial failed")
+	case CloseIdleTimeout:
+		return errors.New("3004: idle timeout")
 	case 1001:
 		return errors.New("1001: Going Away")
 	case 1002:
@@ -0,0 +1,181 @@
+package frame
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"unicode/utf8"
+)
+
+// Role          编解码器的角色,决定掩码的处理
+type Role byte
+
+const (
+	RoleNone   Role = iota // 未指定:发送时不添加掩码,接收时不校验掩码
+	RoleServer             // 服务端:发送时不添加掩码,严格模式下接收的帧必须有掩码
+	RoleClient             // 客户端:发送时添加随机掩码,严格模式下接收的帧不能有掩码
+)
+
+/*
+CodecOptions             编解码器配置
+  - MaxFrameSize         接收的单个帧的最大负载,0:PayloadMaxLength
+  - MaxMessageSize       接收的合并分包后消息的最大长度,0:不限制
+  - FragmentSize         发送消息的分包大小,0或超过 PayloadMaxLength 时为 PayloadMaxLength
+  - Strict               严格校验:RSV位必须为0,不能使用保留的opcode,控制帧不能分包且负载不超过125字节,按角色校验掩码,关闭帧的负载不能只有一个字节
+  - Role                 角色
+*/
+type CodecOptions struct {
+	MaxFrameSize   uint64
+	MaxMessageSize uint64
+	FragmentSize   int
+	Strict         bool
+	Role           Role
+}
+
+// NewCodecWithOptions    生成一个指定配置的解码器
+func NewCodecWithOptions(opt CodecOptions) CodecInterface {
+	if opt.MaxFrameSize == 0 {
+		opt.MaxFrameSize = PayloadMaxLength
+	}
+	if opt.FragmentSize <= 0 || opt.FragmentSize > PayloadMaxLength {
+		opt.FragmentSize = PayloadMaxLength
+	}
+	return &codec{opt: opt}
+}
+
+type codec struct {
+	opt CodecOptions
+}
+
+func (c *codec) Options() CodecOptions {
+	return c.opt
+}
+
+func (c *codec) Check(f *Frame) CloseStatus {
+	if !c.opt.Strict {
+		return CloseNormalClosure
+	}
+	if f.Rsv1 != 0 || f.Rsv2 != 0 || f.Rsv3 != 0 {
+		return CloseProtocolError
+	}
+	switch f.Opcode {
+	case 0x00, 0x01, 0x02:
+	case 0x08, 0x09, 0x0A:
+		if f.Fin != 0x01 || f.PayloadLength > 125 {
+			return CloseProtocolError
+		}
+		if f.Opcode == 0x08 && f.PayloadLength == 1 {
+			return CloseProtocolError
+		}
+	default:
+		return CloseProtocolError
+	}
+	if c.opt.Role == RoleServer && f.Masked != 0x01 {
+		return CloseProtocolError
+	}
+	if c.opt.Role == RoleClient && f.Masked != 0x00 {
+		return CloseProtocolError
+	}
+	return CloseNormalClosure
+}
+
+func (c *codec) EncodeFrame(f *Frame) ([]byte, error) {
+	c.mask(f)
+	return f.ToBytes()
+}
+
+func (c *codec) EncodeFrameBuffers(f *Frame) (net.Buffers, error) {
+	c.mask(f)
+	return f.ToBuffers()
+}
+
+func (c *codec) EncodeMessage(opcode byte, payload []byte) ([]byte, error) {
+	bufs, err := c.EncodeMessageBuffers(opcode, payload)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, bs := range bufs {
+		n += len(bs)
+	}
+	framesBytes := make([]byte, 0, n)
+	for _, bs := range bufs {
+		framesBytes = append(framesBytes, bs...)
+	}
+	return framesBytes, nil
+}
+
+func (c *codec) EncodeMessageBuffers(opcode byte, payload []byte) (net.Buffers, error) {
+	switch opcode {
+	case 0x01:
+		if !utf8.Valid(payload) {
+			return nil, errors.New("text bytes is not utf8")
+		}
+	case 0x02:
+	case 0x08, 0x09, 0x0A:
+		if len(payload) > 125 {
+			payload = payload[0:125]
+		}
+		f := new(Frame)
+		f.SetFin(0x01)
+		f.SetOpcode(opcode)
+		f.SetPayload(payload)
+		return c.EncodeFrameBuffers(f)
+	default:
+		return nil, errors.New("opcode must be in 1,2,8,9,10")
+	}
+	chunks := [][]byte{payload}
+	if len(payload) > c.opt.FragmentSize {
+		chunks = packetBytesDivision(payload, c.opt.FragmentSize)
+	}
+	bufs := make(net.Buffers, 0, 2*len(chunks))
+	for index, chunk := range chunks {
+		f := new(Frame)
+		if index == 0 {
+			f.SetOpcode(opcode)
+		}
+		if index == len(chunks)-1 {
+			f.SetFin(0x01)
+		}
+		f.SetPayload(chunk)
+		frameBufs, err := c.EncodeFrameBuffers(f)
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, frameBufs...)
+	}
+	return bufs, nil
+}
+
+// mask             客户端角色时,为没有掩码的帧添加随机掩码
+func (c *codec) mask(f *Frame) {
+	if c.opt.Role == RoleClient && f.Masked == 0 {
+		f.SetMaskingKey(newMaskingKey())
+	}
+}
+
+func (c *codec) NewReader(r io.Reader) *Reader {
+	return NewReader(r, DefaultReaderSize)
+}
+
+func (c *codec) NewDecoder(frameHandle func(f *Frame) error, messageHandle func(byte, net.Buffers) error) *Decoder {
+	d := NewDecoder(DecoderOptions{
+		MaxPayload:    c.opt.MaxFrameSize,
+		MaxMessage:    c.opt.MaxMessageSize,
+		FrameHandle:   frameHandle,
+		MessageHandle: messageHandle,
+	})
+	d.check = c.Check
+	return d
+}
+
+// newMaskingKey     生成一个随机的掩码key
+func newMaskingKey() uint32 {
+	var bs [4]byte
+	if _, err := io.ReadFull(rand.Reader, bs[:]); err != nil {
+		return 0x37fa213d
+	}
+	return binary.BigEndian.Uint32(bs[:])
+}
@@ -0,0 +1,115 @@
+package frame
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func Test_CodecFragment(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 40<<10)
+	for _, role := range []Role{RoleServer, RoleClient} {
+		c := NewCodecWithOptions(CodecOptions{FragmentSize: 16 << 10, Strict: true, Role: role})
+		bs, err := c.EncodeMessage(0x02, payload)
+		if err != nil {
+			t.Fatal("encodeErr: ", err.Error())
+		}
+		var frames []*Frame
+		var message []byte
+		peer := RoleClient
+		if role == RoleClient {
+			peer = RoleServer
+		}
+		d := NewCodecWithOptions(CodecOptions{Strict: true, Role: peer}).NewDecoder(
+			func(f *Frame) error {
+				frames = append(frames, f)
+				return nil
+			},
+			func(opcode byte, p net.Buffers) error {
+				message = bytes.Join(p, nil)
+				return nil
+			})
+		if err = d.Feed(bs); err != nil {
+			t.Fatal("feedErr: ", err.Error())
+		}
+		if len(frames) != 3 {
+			t.Fatal("frames: ", len(frames))
+		}
+		if !bytes.Equal(message, payload) {
+			t.Fatal("message not equal")
+		}
+	}
+}
+
+func Test_CodecStrict(t *testing.T) {
+	c := NewCodecWithOptions(CodecOptions{Strict: true, Role: RoleServer})
+	unmasked := NewPingFrame([]byte("ping"))
+	if s := c.Check(unmasked); s != CloseProtocolError {
+		t.Fatal("unmasked frame status: ", s)
+	}
+	rsv := NewPingFrame([]byte("ping"), 0x11223344)
+	rsv.Rsv1 = 0x01
+	if s := c.Check(rsv); s != CloseProtocolError {
+		t.Fatal("rsv frame status: ", s)
+	}
+	if s := c.Check(NewPingFrame([]byte("ping"), 0x11223344)); s != CloseNormalClosure {
+		t.Fatal("masked frame status: ", s)
+	}
+	if s := NewCodec().Check(rsv); s != CloseNormalClosure {
+		t.Fatal("not strict status: ", s)
+	}
+}
+
+func Test_CodecBuffers(t *testing.T) {
+	payload := bytes.Repeat([]byte("abcdefgh"), 10<<10)
+	for _, role := range []Role{RoleServer, RoleClient} {
+		c := NewCodecWithOptions(CodecOptions{FragmentSize: 30 << 10, Role: role})
+		for _, n := range []int{0, 125, 126, 65535, 65536, len(payload)} {
+			bufs, err := c.EncodeMessageBuffers(0x02, payload[:n])
+			if err != nil {
+				t.Fatal("encodeErr: ", err.Error())
+			}
+			var message []byte
+			d := c.NewDecoder(nil, func(opcode byte, p net.Buffers) error {
+				message = bytes.Join(p, nil)
+				return nil
+			})
+			for _, bs := range bufs {
+				if err = d.Feed(bs); err != nil {
+					t.Fatal("feedErr: ", err.Error())
+				}
+			}
+			if !bytes.Equal(message, payload[:n]) {
+				t.Fatal("message not equal: ", n)
+			}
+		}
+	}
+	f := NewPingFrame([]byte("ping"), 0x11223344)
+	bs, _ := f.ToBytes()
+	bufs, _ := f.ToBuffers()
+	if !bytes.Equal(bs, bytes.Join(bufs, nil)) || string(f.PayloadData) != "ping" {
+		t.Fatal("masked buffers not equal")
+	}
+}
+
+func Benchmark_FrameToBytes(b *testing.B) {
+	f := new(Frame)
+	f.SetFin(0x01)
+	f.SetOpcode(0x02)
+	f.SetPayload(make([]byte, 1<<20))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.ToBytes()
+	}
+}
+
+func Benchmark_FrameToBuffers(b *testing.B) {
+	f := new(Frame)
+	f.SetFin(0x01)
+	f.SetOpcode(0x02)
+	f.SetPayload(make([]byte, 1<<20))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f.ToBuffers()
+	}
+}
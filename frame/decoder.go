@@ -0,0 +1,284 @@
+package frame
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+/*
+DecoderOptions             Decoder 配置
+  - MaxPayload             单个帧负载的最大长度,0:PayloadMaxLength
+  - MaxMessage             合并后消息的最大长度,0:不限制
+  - FrameHandle            每解码出一个帧(包括控制帧及数据帧的每个分包)后的回调,返回错误时停止解码
+  - MessageHandle          消息回调,payload 是消息各分包的负载(不合并,不复制),不分包的消息及控制帧只有一个元素,空消息为nil;返回错误时停止解码
+*/
+type DecoderOptions struct {
+	MaxPayload    uint64
+	MaxMessage    uint64
+	FrameHandle   func(f *Frame) error
+	MessageHandle func(opcode byte, payload net.Buffers) error
+}
+
+// decoder的解码阶段
+const (
+	decodeHeader  = iota // 读取帧头
+	decodePayload        // 读取负载
+)
+
+/*
+Decoder                    推送模式的帧解码器,用于事件驱动(如netpoll)的服务
+  - Feed 接收任意长度的字节流,不完整的帧头与负载保存在 Decoder 中,在之后的 Feed 中继续解码
+  - 控制帧及未开启消息回调时,负载只从输入复制一次,复制到帧自己的缓冲区(来自缓冲池,可以用 Frame.Release 归还)
+  - 开启消息回调时,不分包的消息直接复制到消息的缓冲区,只复制一次;分包消息的每个分包保存在各自的缓冲区,
+    最后一个分包完整后按总长度合并一次,即每个字节最多复制两次,不会因扩容而反复复制之前的分包
+  - 负载在复制后原地解码掩码
+  - 不能并发使用
+*/
+type Decoder struct {
+	opt       DecoderOptions
+	stage     int
+	header    [maxHeaderLength]byte
+	headerLen int
+	frame     *Frame
+	payload   []byte      // 当前帧负载的目标缓冲区
+	offset    int         // 当前帧已读取的负载长度
+	maskPos   int         // 当前帧的掩码位置
+	opcode    byte        // 未完成消息的opcode,0:没有未完成的消息
+	fragments net.Buffers // 未完成消息的分包负载
+	msgLen    uint64      // 未完成消息的负载长度
+	err       error
+	check     func(f *Frame) CloseStatus
+}
+
+// NewDecoder         生成一个 Decoder
+func NewDecoder(opt DecoderOptions) *Decoder {
+	if opt.MaxPayload == 0 {
+		opt.MaxPayload = PayloadMaxLength
+	}
+	return &Decoder{opt: opt}
+}
+
+// Reset              清空未完成的帧与消息,及之前的错误
+func (d *Decoder) Reset() {
+	d.stage = decodeHeader
+	d.headerLen = 0
+	d.frame = nil
+	d.payload = nil
+	d.offset = 0
+	d.maskPos = 0
+	d.opcode = 0
+	d.fragments = nil
+	d.msgLen = 0
+	d.err = nil
+}
+
+// Buffered           返回未完成的帧已接收的字节数
+func (d *Decoder) Buffered() int {
+	if d.stage == decodeHeader {
+		return d.headerLen
+	}
+	return d.headerLen + d.offset
+}
+
+/*
+Feed                  解码一段字节流,bs在返回后可以复用
+  - 返回协议错误(*DecodeError)或回调返回的错误
+  - 返回错误后 Decoder 不再可用,之后的 Feed 都返回该错误,直到 Reset
+*/
+func (d *Decoder) Feed(bs []byte) error {
+	if d.err != nil {
+		return d.err
+	}
+	for len(bs) > 0 {
+		if d.stage == decodeHeader {
+			bs = d.feedHeader(bs)
+		} else {
+			bs = d.feedPayload(bs)
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+	return nil
+}
+
+// feedHeader         读取帧头,完整后进入读取负载阶段
+func (d *Decoder) feedHeader(bs []byte) []byte {
+	need := 2
+	if d.headerLen >= 2 {
+		need = headerLength(d.header[0:2])
+	}
+	for d.headerLen < need && len(bs) > 0 {
+		n := copy(d.header[d.headerLen:need], bs)
+		d.headerLen += n
+		bs = bs[n:]
+		if d.headerLen == 2 {
+			need = headerLength(d.header[0:2])
+		}
+	}
+	if d.headerLen < need {
+		return bs
+	}
+	d.parseHeader()
+	return bs
+}
+
+// headerLength       根据帧头的前两个字节,计算帧头的长度
+func headerLength(h []byte) int {
+	n := 2
+	switch h[1] & 0x7F {
+	case 0x7E:
+		n += 2
+	case 0x7F:
+		n += 8
+	}
+	if h[1]>>7 == 0x01 {
+		n += 4
+	}
+	return n
+}
+
+// parseHeader        解析完整的帧头,并准备负载的缓冲区
+func (d *Decoder) parseHeader() {
+	h := d.header[:d.headerLen]
+	f := new(Frame)
+	f.Fin = h[0] >> 7
+	f.Rsv1 = h[0] << 1 >> 7
+	f.Rsv2 = h[0] << 2 >> 7
+	f.Rsv3 = h[0] << 3 >> 7
+	f.Opcode = h[0] << 4 >> 4
+	f.Masked = h[1] >> 7
+	pos := 2
+	switch h[1] & 0x7F {
+	case 0x7E:
+		f.PayloadLength = uint64(binary.BigEndian.Uint16(h[2:4]))
+		pos = 4
+	case 0x7F:
+		f.PayloadLength = binary.BigEndian.Uint64(h[2:10])
+		pos = 10
+		// 最高位必须为0
+		if f.PayloadLength>>63 != 0 {
+			d.fail(CloseProtocolError)
+			return
+		}
+	default:
+		f.PayloadLength = uint64(h[1] & 0x7F)
+	}
+	if f.PayloadLength > d.opt.MaxPayload {
+		d.fail(CloseMessageTooBig)
+		return
+	}
+	if f.Masked == 0x01 {
+		f.MaskingKey = binary.BigEndian.Uint32(h[pos : pos+4])
+	}
+	if d.check != nil {
+		if status := d.check(f); status != CloseNormalClosure {
+			d.fail(status)
+			return
+		}
+	}
+	d.frame = f
+	d.offset = 0
+	d.maskPos = 0
+	d.stage = decodePayload
+	length := int(f.PayloadLength)
+	if f.Opcode < 8 && d.opt.MessageHandle != nil {
+		// 数据帧开始新消息时不能有未完成的消息,延续帧必须有未完成的消息
+		if (f.Opcode == 0) != (d.opcode != 0) {
+			d.fail(CloseProtocolError)
+			return
+		}
+		if f.Opcode != 0 {
+			d.opcode = f.Opcode
+			d.fragments = nil
+			d.msgLen = 0
+		}
+		if d.opt.MaxMessage > 0 && d.msgLen+f.PayloadLength > d.opt.MaxMessage {
+			d.fail(CloseMessageTooBig)
+			return
+		}
+		d.msgLen += f.PayloadLength
+		// 负载交给消息回调,按实际长度分配,不使用缓冲池
+		d.payload = make([]byte, length)
+	} else if length > 0 {
+		d.payload = GetBuffer(length)
+		f.pooled = true
+	} else {
+		d.payload = nil
+	}
+	if length == 0 {
+		d.finishFrame()
+	}
+}
+
+// feedPayload        复制负载到目标缓冲区,完整后回调
+func (d *Decoder) feedPayload(bs []byte) []byte {
+	n := copy(d.payload[d.offset:], bs)
+	if d.frame.Masked == 0x01 {
+		d.maskPos = MaskBytes(d.frame.MaskingKey, d.maskPos, d.payload[d.offset:d.offset+n])
+	}
+	d.offset += n
+	if d.offset == len(d.payload) {
+		d.finishFrame()
+	}
+	return bs[n:]
+}
+
+// finishFrame        一个帧完整后,执行回调,并进入读取帧头阶段
+func (d *Decoder) finishFrame() {
+	f := d.frame
+	if len(d.payload) > 0 {
+		f.PayloadData = d.payload
+	}
+	d.stage = decodeHeader
+	d.headerLen = 0
+	d.frame = nil
+	d.payload = nil
+	if d.opt.FrameHandle != nil {
+		if err := d.opt.FrameHandle(f); err != nil {
+			d.err = err
+			return
+		}
+	}
+	if d.opt.MessageHandle == nil {
+		return
+	}
+	if f.Opcode >= 8 {
+		var payload net.Buffers
+		if len(f.PayloadData) > 0 {
+			payload = net.Buffers{f.PayloadData}
+		}
+		if err := d.opt.MessageHandle(f.Opcode, payload); err != nil {
+			d.err = err
+		}
+		return
+	}
+	if len(f.PayloadData) > 0 {
+		d.fragments = append(d.fragments, f.PayloadData)
+	}
+	if f.Fin == 0x01 {
+		opcode, message := d.opcode, d.fragments
+		d.opcode = 0
+		d.fragments = nil
+		d.msgLen = 0
+		if err := d.opt.MessageHandle(opcode, message); err != nil {
+			d.err = err
+		}
+	}
+}
+
+func (d *Decoder) fail(status CloseStatus) {
+	d.err = &DecodeError{Status: status}
+}
+
+// DecodeError        Decoder 检测到的协议错误,Status 可以用作关闭帧的状态码
+type DecodeError struct {
+	Status CloseStatus
+}
+
+func (e *DecodeError) Error() string {
+	if err := StatusToError(e.Status); err != nil {
+		return err.Error()
+	}
+	return "decode failed"
+}
@@ -0,0 +1,190 @@
+package frame
+
+import (
+	"bytes"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// testFragmentsBytes    将payload按size分包,生成一个分包消息,每个分包之间插入一个ping帧
+func testFragmentsBytes(t *testing.T, payload []byte, size int) []byte {
+	var buf bytes.Buffer
+	chunks := packetBytesDivision(payload, size)
+	for i, chunk := range chunks {
+		f := new(Frame)
+		if i == 0 {
+			f.SetOpcode(0x01)
+		}
+		if i == len(chunks)-1 {
+			f.SetFin(0x01)
+		}
+		f.SetMaskingKey(uint32(0x11223344 + i))
+		f.SetPayload(chunk)
+		bs, err := f.ToBytes()
+		if err != nil {
+			t.Fatal("toBytesErr: ", err.Error())
+		}
+		buf.Write(bs)
+		ping, _ := NewPingFrame([]byte("ping"), 0x55667788).ToBytes()
+		buf.Write(ping)
+	}
+	return buf.Bytes()
+}
+
+// feedChunks           将bs随机分段送入 Decoder
+func feedChunks(d *Decoder, bs []byte, r *rand.Rand) error {
+	for len(bs) > 0 {
+		n := r.Intn(len(bs)) + 1
+		if err := d.Feed(bs[:n]); err != nil {
+			return err
+		}
+		bs = bs[n:]
+	}
+	return nil
+}
+
+func Test_DecoderFrames(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 125, 126, 4096, 65535, 65536} {
+		bs := testFramesBytes(t, size, 5, size%2 == 0)
+		var got []*Frame
+		d := NewDecoder(DecoderOptions{FrameHandle: func(f *Frame) error {
+			got = append(got, f)
+			return nil
+		}})
+		if err := feedChunks(d, bs, r); err != nil {
+			t.Fatalf("size=%d feedErr: %s", size, err.Error())
+		}
+		if len(got) != 5 || d.Buffered() != 0 {
+			t.Fatalf("size=%d frames=%d buffered=%d", size, len(got), d.Buffered())
+		}
+		_, want, _ := ReadOnceFrame(bytes.NewReader(bs))
+		for _, f := range got {
+			if f.PayloadLength != want.PayloadLength || !bytes.Equal(f.PayloadData, want.PayloadData) {
+				t.Fatalf("size=%d payload mismatch", size)
+			}
+			f.Release()
+		}
+	}
+}
+
+func Test_DecoderMessages(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	bs := testFragmentsBytes(t, payload, 777)
+	var pings int
+	var messages [][]byte
+	d := NewDecoder(DecoderOptions{MessageHandle: func(opcode byte, p net.Buffers) error {
+		if opcode == 0x09 {
+			pings++
+		} else if opcode == 0x01 {
+			messages = append(messages, bytes.Join(p, nil))
+		} else {
+			t.Fatal("unexpected opcode ", opcode)
+		}
+		return nil
+	}})
+	// 逐字节送入
+	for i := range bs {
+		if err := d.Feed(bs[i : i+1]); err != nil {
+			t.Fatal("feedErr: ", err.Error())
+		}
+	}
+	if err := feedChunks(d, bs, r); err != nil {
+		t.Fatal("feedErr: ", err.Error())
+	}
+	if len(messages) != 2 || pings != 2*len(packetBytesDivision(payload, 777)) {
+		t.Fatalf("messages=%d pings=%d", len(messages), pings)
+	}
+	for _, m := range messages {
+		if !bytes.Equal(m, payload) {
+			t.Fatal("message mismatch")
+		}
+	}
+}
+
+func Test_DecoderMessageCopy(t *testing.T) {
+	var frames [][]byte
+	var messages []net.Buffers
+	d := NewDecoder(DecoderOptions{
+		FrameHandle: func(f *Frame) error {
+			if f.Opcode < 8 {
+				frames = append(frames, f.PayloadData)
+			}
+			return nil
+		},
+		MessageHandle: func(opcode byte, p net.Buffers) error {
+			if opcode < 8 {
+				messages = append(messages, p)
+			}
+			return nil
+		},
+	})
+	payload := bytes.Repeat([]byte("abc"), 1000)
+	f, _ := NewTextFrame(payload, 0x11223344)
+	bs, _ := f.ToBytes()
+	if err := d.Feed(bs); err != nil {
+		t.Fatal("feedErr: ", err.Error())
+	}
+	// 不分包的消息就是帧的负载,不再复制
+	if len(messages) != 1 || len(messages[0]) != 1 || &messages[0][0][0] != &frames[0][0] {
+		t.Fatal("unfragmented message copied")
+	}
+	// 分包消息的每个分包就是各自帧的负载,不合并
+	frames, messages = nil, nil
+	if err := d.Feed(testFragmentsBytes(t, payload, 700)); err != nil {
+		t.Fatal("feedErr: ", err.Error())
+	}
+	if len(messages) != 1 || len(messages[0]) != len(frames) || !bytes.Equal(bytes.Join(messages[0], nil), payload) {
+		t.Fatal("fragmented message mismatch")
+	}
+	for i, bs := range messages[0] {
+		if &bs[0] != &frames[i][0] || cap(bs) != len(bs) {
+			t.Fatal("fragment copied: ", i)
+		}
+	}
+	// 空消息
+	frames, messages = nil, nil
+	if err := d.Feed([]byte{0x81, 0x80, 0x11, 0x22, 0x33, 0x44}); err != nil {
+		t.Fatal("feedErr: ", err.Error())
+	}
+	if len(messages) != 1 || messages[0] != nil {
+		t.Fatal("empty message: ", messages)
+	}
+}
+
+func Test_DecoderErrors(t *testing.T) {
+	// 没有未完成的消息时收到延续帧
+	d := NewDecoder(DecoderOptions{MessageHandle: func(byte, net.Buffers) error { return nil }})
+	err := d.Feed([]byte{0x80, 0x00})
+	if e, ok := err.(*DecodeError); !ok || e.Status != CloseProtocolError {
+		t.Fatal("expected CloseProtocolError, got ", err)
+	}
+	if d.Feed([]byte{0x81, 0x00}) != err {
+		t.Fatal("decoder should keep the error until Reset")
+	}
+	d.Reset()
+	if err := d.Feed([]byte{0x81, 0x00}); err != nil {
+		t.Fatal("feedErr after Reset: ", err.Error())
+	}
+	// 负载超长
+	d = NewDecoder(DecoderOptions{MaxPayload: 100})
+	err = d.Feed(testFramesBytes(t, 200, 1, false)[:4])
+	if e, ok := err.(*DecodeError); !ok || e.Status != CloseMessageTooBig {
+		t.Fatal("expected CloseMessageTooBig, got ", err)
+	}
+}
+
+func Test_ReadStreamBufferBytes(t *testing.T) {
+	for _, size := range []int{10, 300, 70000} {
+		bs := testFramesBytes(t, size, 2, true)
+		list, rest, status := ReadStreamBufferBytes(append(bs, bs[:3]...))
+		if status != CloseNormalClosure || len(list) != 2 || len(rest) != 3 {
+			t.Fatalf("size=%d frames=%d rest=%d status=%d", size, len(list), len(rest), status)
+		}
+		if len(list[1].PayloadData) != size {
+			t.Fatalf("size=%d payload=%d", size, len(list[1].PayloadData))
+		}
+	}
+}
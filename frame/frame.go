@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"unicode/utf8"
 )
 
@@ -31,6 +32,19 @@ type Frame struct {
 	PayloadLength uint64 // 7 或者 7+16 或者 7+64 bit: 以字节为单位的“有效负载数据”长度，如果值为 0-125，那么就表示负载数据的长度。如果是 126，那么接下来的 2 个 bytes 解释为 16bit 的无符号整形作为负载数据的长度。如果是 127，那么接下来的 8 个 bytes 解释为一个 64bit 的无符号整形（最高位的 bit 必须为 0）作为负载数据的长度
 	MaskingKey    uint32 // 32 bit,加/解密key
 	PayloadData   []byte // 负载
+	pooled        bool   // 负载是否来自缓冲池
+}
+
+/*
+Release              归还 Reader 读取的负载到缓冲池,之后不能再使用 PayloadData
+  - 负载不是来自缓冲池时,只清空 PayloadData
+*/
+func (f *Frame) Release() {
+	if f.pooled {
+		PutBuffer(f.PayloadData)
+		f.pooled = false
+	}
+	f.PayloadData = nil
 }
 
 func (f *Frame) ToString() string {
@@ -60,6 +74,7 @@ PayloadData: %s,
 func (f *Frame) SetPayload(data []byte) {
 	if data != nil && len(data) > 0 {
 		f.PayloadData = data
+		f.pooled = false
 	}
 }
 func (f *Frame) SetFin(b byte) {
@@ -74,37 +89,65 @@ func (f *Frame) SetOpcode(b byte) {
 
 }
 func (f *Frame) ToBytes() ([]byte, error) {
-	var payloadLength = uint64(0)
-	var frameBytes, lengthBytes, data, enData []byte
-	firstByte := f.Fin<<7 + f.Rsv1<<6 + f.Rsv2<<5 + f.Rsv3<<4 + f.Opcode<<4>>4
-	frameBytes = []byte{firstByte}
-	if f.PayloadData != nil && len(f.PayloadData) > 0 {
-		payloadLength = uint64(len(f.PayloadData))
-		data = f.PayloadData
-	} else {
-		data = []byte{}
+	frameBytes, err := f.AppendHeader(make([]byte, 0, maxHeaderLength+len(f.PayloadData)))
+	if err != nil {
+		return nil, err
 	}
+	n := len(frameBytes)
+	frameBytes = append(frameBytes, f.PayloadData...)
+	if f.Masked == 0x01 {
+		MaskBytes(f.MaskingKey, 0, frameBytes[n:])
+	}
+	return frameBytes, nil
+}
+
+// AppendHeader         把帧头(第一字节,长度,掩码key)追加到dst,负载长度以 PayloadData 为准
+func (f *Frame) AppendHeader(dst []byte) ([]byte, error) {
+	payloadLength := uint64(len(f.PayloadData))
+	if payloadLength > PayloadMaxLength {
+		return nil, errors.New("frame payload to long")
+	}
+	dst = append(dst, f.Fin<<7+f.Rsv1<<6+f.Rsv2<<5+f.Rsv3<<4+f.Opcode<<4>>4)
 	if payloadLength <= 125 {
-		lengthBytes = []byte{f.Masked<<7 + uint8(payloadLength)}
-	} else if payloadLength > 125 && payloadLength <= 65535 {
-		lengthBytes = []byte{f.Masked<<7 + 0x7E}
-		lengthBytes = append(lengthBytes, enCodeUint16(uint16(payloadLength))...)
-	} else if payloadLength > 65535 && payloadLength <= PayloadMaxLength {
-		lengthBytes = []byte{f.Masked<<7 + 0x7F}
-		lengthBytes = append(lengthBytes, enCodeUin64(payloadLength)...)
+		dst = append(dst, f.Masked<<7+uint8(payloadLength))
+	} else if payloadLength <= 65535 {
+		dst = append(dst, f.Masked<<7+0x7E, byte(payloadLength>>8), byte(payloadLength))
 	} else {
-		return nil, errors.New("frame payload to long")
+		dst = append(dst, f.Masked<<7+0x7F)
+		var bs [8]byte
+		binary.BigEndian.PutUint64(bs[:], payloadLength)
+		dst = append(dst, bs[:]...)
 	}
-	frameBytes = append(frameBytes, lengthBytes...)
 	if f.Masked == 0x01 {
-		frameBytes = append(frameBytes, enCodeUint32(f.MaskingKey)...)
-		enData = MasKingPayloadBytes(data, f.MaskingKey)
-	} else {
-		enData = data
+		var bs [4]byte
+		binary.BigEndian.PutUint32(bs[:], f.MaskingKey)
+		dst = append(dst, bs[:]...)
 	}
-	frameBytes = append(frameBytes, enData...)
-	return frameBytes, nil
+	return dst, nil
+}
+
+/*
+ToBuffers            把帧编码为帧头与负载两段,用于 net.Buffers 的向量写入(writev)
+  - 没有掩码时负载不复制,直接引用 PayloadData,写入完成之前不能修改
+  - 有掩码时负载复制后再加密,不修改 PayloadData
+*/
+func (f *Frame) ToBuffers() (net.Buffers, error) {
+	header, err := f.AppendHeader(make([]byte, 0, maxHeaderLength))
+	if err != nil {
+		return nil, err
+	}
+	if len(f.PayloadData) == 0 {
+		return net.Buffers{header}, nil
+	}
+	payload := f.PayloadData
+	if f.Masked == 0x01 {
+		payload = make([]byte, len(f.PayloadData))
+		copy(payload, f.PayloadData)
+		MaskBytes(f.MaskingKey, 0, payload)
+	}
+	return net.Buffers{header, payload}, nil
 }
+
 func (f *Frame) SetMaskingKey(key uint32) {
 	f.Masked = 1
 	f.MaskingKey = key
@@ -112,6 +155,11 @@ func (f *Frame) SetMaskingKey(key uint32) {
 
 // read         读取一个webSocket帧,返回读取的长度
 func (f *Frame) read(r io.Reader) (int, CloseStatus) {
+	return f.readLimit(r, PayloadMaxLength)
+}
+
+// readLimit    读取一个webSocket帧,负载超过maxPayload时返回 CloseMessageTooBig,maxPayload为0时不限制
+func (f *Frame) readLimit(r io.Reader, maxPayload uint64) (int, CloseStatus) {
 	var n int
 	firstByte, err := readByte(r)
 	if err != nil {
@@ -145,14 +193,18 @@ func (f *Frame) read(r io.Reader) (int, CloseStatus) {
 		if u64Err != nil {
 			return n, CloseGoingAway
 		}
-		if length64 > PayloadMaxLength {
-			return n, CloseMessageTooBig
-		}
 		n += 8
+		// 最高位必须为0
+		if length64>>63 != 0 {
+			return n, CloseProtocolError
+		}
 		f.PayloadLength = length64
 	} else {
 		return n, CloseInvalidFramePayloadData
 	}
+	if maxPayload > 0 && f.PayloadLength > maxPayload {
+		return n, CloseMessageTooBig
+	}
 	if f.Masked == 0x01 {
 		key, keyErr := readUint32(r)
 		if keyErr != nil {
@@ -183,6 +235,13 @@ func ReadOnceFrame(r io.Reader) (int, *Frame, CloseStatus) {
 	return readLen, f, status
 }
 
+// ReadOnceFrameLimit        阻塞模式下读取一个 Frame,负载超过maxPayload时返回 CloseMessageTooBig,maxPayload为0时不限制
+func ReadOnceFrameLimit(r io.Reader, maxPayload uint64) (int, *Frame, CloseStatus) {
+	f := new(Frame)
+	readLen, status := f.readLimit(r, maxPayload)
+	return readLen, f, status
+}
+
 // ReadStreamBufferBytes    读取缓冲区的字节流
 func ReadStreamBufferBytes(framesBytes []byte) ([]*Frame, []byte, CloseStatus) {
 	if framesBytes == nil && len(framesBytes) < 1 {
@@ -208,12 +267,20 @@ func ReadStreamBufferBytes(framesBytes []byte) ([]*Frame, []byte, CloseStatus) {
 			if len(framesBytes) < 4 {
 				return list, framesBytes, CloseNormalClosure
 			}
-			frameLength = 2 + int(binary.BigEndian.Uint64([]byte{framesBytes[2], framesBytes[3]})) + maskedLen
+			frameLength = 4 + int(binary.BigEndian.Uint16(framesBytes[2:4])) + maskedLen
 		} else if payloadLen == 0x7F {
 			if len(framesBytes) < 10 {
 				return list, framesBytes, CloseNormalClosure
 			}
-			frameLength = 2 + int(binary.BigEndian.Uint64(framesBytes[2:10])) + maskedLen
+			length64 := binary.BigEndian.Uint64(framesBytes[2:10])
+			// 最高位必须为0
+			if length64>>63 != 0 {
+				return list, framesBytes, CloseProtocolError
+			}
+			if length64 > PayloadMaxLength {
+				return list, framesBytes, CloseMessageTooBig
+			}
+			frameLength = 10 + int(length64) + maskedLen
 		}
 		if len(framesBytes) < frameLength {
 			return list, framesBytes, CloseNormalClosure
@@ -0,0 +1,30 @@
+package frame
+
+import "encoding/binary"
+
+/*
+MaskBytes              原地加/解密负载,与 MasKingPayloadBytes 的结果相同,但不分配内存,每次处理8字节
+  - key                掩码key,与 Frame.MaskingKey 相同
+  - pos                buf[0] 在负载中对应的掩码位置(0~3),负载分多次处理时传入上一次的返回值
+  - 返回处理buf后的掩码位置
+*/
+func MaskBytes(key uint32, pos int, buf []byte) int {
+	var keyBytes [4]byte
+	binary.BigEndian.PutUint32(keyBytes[:], key)
+	pos &= 3
+	// 按起始位置旋转掩码,扩展为8字节
+	var wideBytes [8]byte
+	for i := range wideBytes {
+		wideBytes[i] = keyBytes[(pos+i)&3]
+	}
+	wide := binary.LittleEndian.Uint64(wideBytes[:])
+	n := len(buf) &^ 7
+	for i := 0; i < n; i += 8 {
+		b := buf[i : i+8 : i+8]
+		binary.LittleEndian.PutUint64(b, binary.LittleEndian.Uint64(b)^wide)
+	}
+	for i := n; i < len(buf); i++ {
+		buf[i] ^= keyBytes[(pos+i)&3]
+	}
+	return (pos + len(buf)) & 3
+}
@@ -0,0 +1,71 @@
+package frame
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// MaskBytes 与 MasKingPayloadBytes 的结果相同
+func Test_MaskBytes(t *testing.T) {
+	f := func(key uint32, payload []byte) bool {
+		want := MasKingPayloadBytes(payload, key)
+		got := append([]byte(nil), payload...)
+		pos := MaskBytes(key, 0, got)
+		return bytes.Equal(got, want) && pos == len(payload)%4
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 负载任意分段处理,传入上一次返回的位置,结果与一次处理相同
+func Test_MaskBytesStream(t *testing.T) {
+	f := func(key uint32, payload []byte, seed int64) bool {
+		want := MasKingPayloadBytes(payload, key)
+		got := append([]byte(nil), payload...)
+		r := rand.New(rand.NewSource(seed))
+		pos := 0
+		for rest := got; len(rest) > 0; {
+			n := r.Intn(len(rest) + 1)
+			pos = MaskBytes(key, pos, rest[:n])
+			rest = rest[n:]
+		}
+		return bytes.Equal(got, want) && pos == len(payload)%4
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 加密两次等于原文
+func Test_MaskBytesInvolution(t *testing.T) {
+	f := func(key uint32, pos int, payload []byte) bool {
+		got := append([]byte(nil), payload...)
+		MaskBytes(key, pos, got)
+		MaskBytes(key, pos, got)
+		return bytes.Equal(got, payload)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkMasKingPayloadBytes_64K(b *testing.B) {
+	payload := make([]byte, 64<<10)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MasKingPayloadBytes(payload, 0x37fa213d)
+	}
+}
+
+func BenchmarkMaskBytes_64K(b *testing.B) {
+	payload := make([]byte, 64<<10)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		MaskBytes(0x37fa213d, i&3, payload)
+	}
+}
@@ -0,0 +1,130 @@
+package frame
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// DefaultReaderSize     Reader 默认的读缓冲大小
+const DefaultReaderSize = 4096
+
+// maxHeaderLength       帧头的最大长度:2字节+8字节扩展长度+4字节掩码
+const maxHeaderLength = 14
+
+/*
+Reader                   带缓冲的帧读取器,一个链接对应一个 Reader,不能并发使用
+  - 帧头解析到固定数组,不产生内存分配
+  - 负载从分级的缓冲池获取,并原地解码掩码;用完后可以调用 Frame.Release 归还
+  - 数据帧的负载交给不会归还的使用方(如消息回调)时,用 SetDataPooled(false) 按实际长度分配
+*/
+type Reader struct {
+	br           *bufio.Reader
+	header       [maxHeaderLength]byte
+	headerHandle func()
+	unpooledData bool
+}
+
+// NewReader             生成一个 Reader,size<=0时使用 DefaultReaderSize
+func NewReader(r io.Reader, size int) *Reader {
+	if size <= 0 {
+		size = DefaultReaderSize
+	}
+	return &Reader{br: bufio.NewReaderSize(r, size)}
+}
+
+// Buffered              返回缓冲区中未读取的字节数
+func (r *Reader) Buffered() int {
+	return r.br.Buffered()
+}
+
+// SetHeaderHandle       配置帧头读取完成后(读取负载之前)的回调,用于区分帧头与负载的读取,如只限制帧头的读取速率
+func (r *Reader) SetHeaderHandle(f func()) {
+	r.headerHandle = f
+}
+
+// SetDataPooled         数据帧的负载是否从缓冲池获取,默认为true;为false时按实际长度分配,不会因分级取整而长期占用更大的缓冲区;控制帧总是从缓冲池获取
+func (r *Reader) SetDataPooled(b bool) {
+	r.unpooledData = !b
+}
+
+// ReadFrame             阻塞模式下读取一个 Frame,负载超过maxPayload时返回 CloseMessageTooBig,maxPayload为0时不限制
+func (r *Reader) ReadFrame(maxPayload uint64) (int, *Frame, CloseStatus) {
+	f := new(Frame)
+	n, status := r.readFrame(f, maxPayload)
+	return n, f, status
+}
+
+func (r *Reader) readFrame(f *Frame, maxPayload uint64) (int, CloseStatus) {
+	h := r.header[:]
+	if _, err := io.ReadFull(r.br, h[0:2]); err != nil {
+		return 0, CloseGoingAway
+	}
+	n := 2
+	f.Fin = h[0] >> 7
+	f.Rsv1 = h[0] << 1 >> 7
+	f.Rsv2 = h[0] << 2 >> 7
+	f.Rsv3 = h[0] << 3 >> 7
+	f.Opcode = h[0] << 4 >> 4
+	f.Masked = h[1] >> 7
+	length := h[1] << 1 >> 1
+	extLen := 0
+	if length == 0x7E {
+		extLen = 2
+	} else if length == 0x7F {
+		extLen = 8
+	}
+	keyLen := 0
+	if f.Masked == 0x01 {
+		keyLen = 4
+	}
+	if extLen+keyLen > 0 {
+		if _, err := io.ReadFull(r.br, h[2:2+extLen+keyLen]); err != nil {
+			return n, CloseGoingAway
+		}
+		n += extLen + keyLen
+	}
+	switch extLen {
+	case 0:
+		f.PayloadLength = uint64(length)
+	case 2:
+		f.PayloadLength = uint64(binary.BigEndian.Uint16(h[2:4]))
+	default:
+		f.PayloadLength = binary.BigEndian.Uint64(h[2:10])
+		// 最高位必须为0
+		if f.PayloadLength>>63 != 0 {
+			return n, CloseProtocolError
+		}
+	}
+	if maxPayload > 0 && f.PayloadLength > maxPayload {
+		return n, CloseMessageTooBig
+	}
+	if keyLen > 0 {
+		f.MaskingKey = binary.BigEndian.Uint32(h[2+extLen : 6+extLen])
+	}
+	if r.headerHandle != nil {
+		r.headerHandle()
+	}
+	if f.PayloadLength > 0 {
+		pooled := f.Opcode >= 8 || !r.unpooledData
+		var payload []byte
+		if pooled {
+			payload = GetBuffer(int(f.PayloadLength))
+		} else {
+			payload = make([]byte, f.PayloadLength)
+		}
+		if _, err := io.ReadFull(r.br, payload); err != nil {
+			if pooled {
+				PutBuffer(payload)
+			}
+			return n, CloseGoingAway
+		}
+		n += int(f.PayloadLength)
+		if keyLen > 0 {
+			MaskBytes(f.MaskingKey, 0, payload)
+		}
+		f.PayloadData = payload
+		f.pooled = pooled
+	}
+	return n, CloseNormalClosure
+}
@@ -0,0 +1,135 @@
+package frame
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// testFramesBytes      生成count个负载长度为size的帧,masked为true时添加掩码
+func testFramesBytes(t testing.TB, size, count int, masked bool) []byte {
+	payload := bytes.Repeat([]byte("websocket"), size/9+1)[:size]
+	var buf bytes.Buffer
+	for i := 0; i < count; i++ {
+		f := new(Frame)
+		f.SetFin(0x01)
+		f.SetOpcode(0x02)
+		f.SetPayload(payload)
+		if masked {
+			f.SetMaskingKey(0x37fa213d)
+		}
+		bs, err := f.ToBytes()
+		if err != nil {
+			t.Fatal("toBytesErr: ", err.Error())
+		}
+		buf.Write(bs)
+	}
+	return buf.Bytes()
+}
+
+func Test_Reader(t *testing.T) {
+	for _, size := range []int{0, 1, 125, 126, 4096, 65535, 65536} {
+		for _, masked := range []bool{false, true} {
+			bs := testFramesBytes(t, size, 3, masked)
+			r := NewReader(bytes.NewReader(bs), 0)
+			for i := 0; i < 3; i++ {
+				n1, want, s1 := ReadOnceFrame(bytes.NewReader(bs[i*len(bs)/3:]))
+				n2, got, s2 := r.ReadFrame(0)
+				if s1 != CloseNormalClosure || s2 != CloseNormalClosure {
+					t.Fatalf("size=%d masked=%v status: %d %d", size, masked, s1, s2)
+				}
+				if n1 != n2 || got.PayloadLength != want.PayloadLength || got.MaskingKey != want.MaskingKey {
+					t.Fatalf("size=%d masked=%v header mismatch", size, masked)
+				}
+				if !bytes.Equal(got.PayloadData, want.PayloadData) {
+					t.Fatalf("size=%d masked=%v payload mismatch", size, masked)
+				}
+				got.Release()
+			}
+			if _, _, s := r.ReadFrame(0); s != CloseGoingAway {
+				t.Fatalf("size=%d masked=%v expected EOF, got %d", size, masked, s)
+			}
+		}
+	}
+}
+
+func Test_ReaderLimit(t *testing.T) {
+	r := NewReader(bytes.NewReader(testFramesBytes(t, 200, 1, true)), 0)
+	if _, _, s := r.ReadFrame(100); s != CloseMessageTooBig {
+		t.Fatal("expected CloseMessageTooBig, got ", s)
+	}
+}
+
+func Test_ReaderDataPooled(t *testing.T) {
+	ping := new(Frame)
+	ping.SetFin(0x01)
+	ping.SetOpcode(0x09)
+	ping.SetPayload([]byte("ping"))
+	pingBytes, _ := ping.ToBytes()
+	size := 33 << 10
+	bs := append(testFramesBytes(t, size, 1, true), pingBytes...)
+	r := NewReader(bytes.NewReader(bs), 0)
+	r.SetDataPooled(false)
+	// 数据帧按实际长度分配,不来自缓冲池
+	_, f, s := r.ReadFrame(0)
+	if s != CloseNormalClosure || len(f.PayloadData) != size || cap(f.PayloadData) != size || f.pooled {
+		t.Fatalf("data frame: status=%d len=%d cap=%d pooled=%v", s, len(f.PayloadData), cap(f.PayloadData), f.pooled)
+	}
+	// 控制帧仍从缓冲池获取
+	_, f, s = r.ReadFrame(0)
+	if s != CloseNormalClosure || string(f.PayloadData) != "ping" || !f.pooled {
+		t.Fatalf("control frame: status=%d payload=%q pooled=%v", s, f.PayloadData, f.pooled)
+	}
+	f.Release()
+	// 默认从缓冲池获取,容量为分级的大小
+	_, f, _ = NewReader(bytes.NewReader(bs), 0).ReadFrame(0)
+	if !f.pooled || cap(f.PayloadData) != 256<<10 {
+		t.Fatalf("pooled data frame: cap=%d pooled=%v", cap(f.PayloadData), f.pooled)
+	}
+	f.Release()
+}
+
+// loopReader        循环读取同一段字节
+type loopReader struct {
+	bs  []byte
+	pos int
+}
+
+func (l *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, l.bs[l.pos:])
+	l.pos = (l.pos + n) % len(l.bs)
+	return n, nil
+}
+
+func benchmarkReadOnceFrame(b *testing.B, size int) {
+	var r io.Reader = &loopReader{bs: testFramesBytes(b, size, 16, true)}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, s := ReadOnceFrame(r); s != CloseNormalClosure {
+			b.Fatal("status: ", s)
+		}
+	}
+}
+
+func benchmarkReader(b *testing.B, size int) {
+	r := NewReader(&loopReader{bs: testFramesBytes(b, size, 16, true)}, 0)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, f, s := r.ReadFrame(0)
+		if s != CloseNormalClosure {
+			b.Fatal("status: ", s)
+		}
+		f.Release()
+	}
+}
+
+func BenchmarkReadOnceFrame_128(b *testing.B) { benchmarkReadOnceFrame(b, 128) }
+func BenchmarkReadOnceFrame_4K(b *testing.B)  { benchmarkReadOnceFrame(b, 4<<10) }
+func BenchmarkReadOnceFrame_64K(b *testing.B) { benchmarkReadOnceFrame(b, 64<<10) }
+func BenchmarkReader_128(b *testing.B)        { benchmarkReader(b, 128) }
+func BenchmarkReader_4K(b *testing.B)         { benchmarkReader(b, 4<<10) }
+func BenchmarkReader_64K(b *testing.B)        { benchmarkReader(b, 64<<10) }
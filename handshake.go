@@ -0,0 +1,360 @@
+package websocket_packet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qdmc/websocket_packet/session"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+HandshakeResponse        握手回复的构造器
+  - Header()             回复的响应头:接受握手时写入101回复,拒绝时写入错误回复
+  - Sec-WebSocket-Protocol 只有在客户端提供了该子协议时才覆盖协商的子协议,否则忽略(RFC 6455 要求客户端断开);Upgrade,Connection,Sec-WebSocket-Accept 会被忽略
+*/
+type HandshakeResponse struct {
+	header http.Header
+}
+
+func newHandshakeResponse() *HandshakeResponse {
+	return &HandshakeResponse{header: http.Header{}}
+}
+
+// Header        返回回复的响应头
+func (r *HandshakeResponse) Header() http.Header {
+	return r.header
+}
+
+/*
+HandshakeDecision        握手的决定
+  - Accept               是否接受握手
+  - Status               拒绝时的http状态码,默认为403
+  - Body                 拒绝时的回复内容,默认为状态码的描述
+*/
+type HandshakeDecision struct {
+	Accept bool
+	Status int
+	Body   string
+}
+
+// AcceptHandshake       接受握手
+func AcceptHandshake() HandshakeDecision {
+	return HandshakeDecision{Accept: true}
+}
+
+// RejectHandshake       拒绝握手
+func RejectHandshake(status int, body string) HandshakeDecision {
+	return HandshakeDecision{Accept: false, Status: status, Body: body}
+}
+
+// HandshakeHandle       握手校验,可以通过 resp.Header() 配置回复的响应头,并返回接受或拒绝的决定
+type HandshakeHandle func(req *http.Request, resp *HandshakeResponse) HandshakeDecision
+
+// 握手被拒绝的原因
+const (
+	HandshakeReasonProtocol = "protocol" // 不是合法的websocket握手请求
+	HandshakeReasonOrigin   = "origin"   // Origin 校验失败
+	HandshakeReasonCheck    = "check"    // 自定义的握手校验拒绝
+	HandshakeReasonHijack   = "hijack"   // Hijack失败
+)
+
+// HandshakeError        握手被拒绝的错误,包含回复的状态码,响应头与内容
+type HandshakeError struct {
+	Status int
+	Header http.Header
+	Body   string
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("handshake rejected(%d): %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("handshake rejected(%d)", e.Status)
+}
+
+// newHandshakeError     生成一个 HandshakeError
+func newHandshakeError(status int, body string, header http.Header) *HandshakeError {
+	if status < 400 || status > 599 {
+		status = http.StatusForbidden
+	}
+	return &HandshakeError{Status: status, Header: header, Body: body}
+}
+
+// decisionToError       拒绝的决定转换成 HandshakeError
+func decisionToError(d HandshakeDecision, resp *HandshakeResponse) error {
+	if d.Accept {
+		return nil
+	}
+	he := newHandshakeError(d.Status, d.Body, resp.header)
+	he.Reason = HandshakeReasonCheck
+	return he
+}
+
+// toHandshakeError      其它错误转换成 HandshakeError,默认回复404
+func toHandshakeError(err error, reason string) *HandshakeError {
+	var he *HandshakeError
+	if errors.As(err, &he) {
+		if he.Reason == "" {
+			he.Reason = reason
+		}
+		return he
+	}
+	return &HandshakeError{Status: http.StatusNotFound, Body: err.Error(), Reason: reason}
+}
+
+// NewRetryAfterError    生成一个带 Retry-After 响应头的 HandshakeError,如:429,503
+func NewRetryAfterError(status int, retryAfterSecond int64, body string) *HandshakeError {
+	header := http.Header{}
+	if retryAfterSecond > 0 {
+		header.Set("Retry-After", strconv.FormatInt(retryAfterSecond, 10))
+	}
+	return newHandshakeError(status, body, header)
+}
+
+// writeHandshakeError    回复握手错误, HandshakeError 按其状态码回复,其它错误回复404
+func writeHandshakeError(w http.ResponseWriter, err error) {
+	var he *HandshakeError
+	if !errors.As(err, &he) {
+		httpResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if he.Reason == HandshakeReasonHijack {
+		return
+	}
+	for key, values := range he.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	body := he.Body
+	if body == "" {
+		body = http.StatusText(he.Status)
+	}
+	http.Error(w, body, he.Status)
+}
+
+/*
+HandshakeAudit           一次握手的审计记录
+  - Nano                 握手的时间
+  - RemoteAddr           对端地址
+  - Host                 请求的Host
+  - Path                 请求的路径
+  - Origin               请求的Origin
+  - Accepted             是否接受
+  - Status               拒绝时回复的状态码,接受时为101
+  - Reason               拒绝的原因,如: protocol,origin,check
+  - Error                拒绝的错误信息
+*/
+type HandshakeAudit struct {
+	Nano       int64
+	RemoteAddr string
+	Host       string
+	Path       string
+	Origin     string
+	Accepted   bool
+	Status     int
+	Reason     string
+	Error      string
+}
+
+/*
+HandshakeMetrics         握手统计
+  - Total                握手总数
+  - Accepted             接受数
+  - Rejected             拒绝数
+  - RejectedReasons      按原因统计的拒绝数
+*/
+type HandshakeMetrics struct {
+	Total           uint64
+	Accepted        uint64
+	Rejected        uint64
+	RejectedReasons map[string]uint64
+}
+
+// handshakeAudit     握手的审计与统计
+type handshakeAudit struct {
+	mu      sync.Mutex
+	metrics HandshakeMetrics
+	cb      func(a HandshakeAudit)
+}
+
+func newHandshakeAudit() *handshakeAudit {
+	return &handshakeAudit{metrics: HandshakeMetrics{RejectedReasons: map[string]uint64{}}}
+}
+
+func (h *handshakeAudit) setCallBack(f func(a HandshakeAudit)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cb = f
+}
+
+// record        记录一次握手,err为空表示接受
+func (h *handshakeAudit) record(req *http.Request, err error) {
+	a := HandshakeAudit{
+		Nano:       time.Now().UnixNano(),
+		RemoteAddr: req.RemoteAddr,
+		Host:       req.Host,
+		Origin:     req.Header.Get("Origin"),
+		Accepted:   err == nil,
+		Status:     http.StatusSwitchingProtocols,
+	}
+	if req.URL != nil {
+		a.Path = req.URL.Path
+	}
+	if err != nil {
+		he := toHandshakeError(err, HandshakeReasonProtocol)
+		a.Status, a.Reason, a.Error = he.Status, he.Reason, err.Error()
+	}
+	h.mu.Lock()
+	h.metrics.Total++
+	if a.Accepted {
+		h.metrics.Accepted++
+	} else {
+		h.metrics.Rejected++
+		h.metrics.RejectedReasons[a.Reason]++
+	}
+	cb := h.cb
+	h.mu.Unlock()
+	if cb != nil {
+		go cb(a)
+	}
+}
+
+// getMetrics      返回统计的拷贝
+func (h *handshakeAudit) getMetrics() HandshakeMetrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	m := h.metrics
+	m.RejectedReasons = make(map[string]uint64, len(h.metrics.RejectedReasons))
+	for k, v := range h.metrics.RejectedReasons {
+		m.RejectedReasons[k] = v
+	}
+	return m
+}
+
+type handshakeValuesKey struct{}
+
+// handshakeValues     握手校验时附加到session上的值
+type handshakeValues struct {
+	mu         sync.Mutex
+	tags       map[string]string
+	values     map[string]interface{}
+	idlePolicy *session.IdlePolicy
+}
+
+// withHandshakeValues     在请求的Context中放入 handshakeValues
+func withHandshakeValues(req *http.Request) (*http.Request, *handshakeValues) {
+	hv := &handshakeValues{tags: map[string]string{}, values: map[string]interface{}{}}
+	return req.WithContext(context.WithValue(req.Context(), handshakeValuesKey{}, hv)), hv
+}
+
+func (hv *handshakeValues) getTags() map[string]string {
+	if hv == nil {
+		return nil
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	tags := make(map[string]string, len(hv.tags))
+	for k, v := range hv.tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+func (hv *handshakeValues) getValues() map[string]interface{} {
+	if hv == nil {
+		return nil
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	values := make(map[string]interface{}, len(hv.values))
+	for k, v := range hv.values {
+		values[k] = v
+	}
+	return values
+}
+
+// getIdlePolicy     返回握手时配置的空闲超时策略,没有配置时返回def
+func (hv *handshakeValues) getIdlePolicy(def session.IdlePolicy) *session.IdlePolicy {
+	if hv != nil {
+		hv.mu.Lock()
+		defer hv.mu.Unlock()
+		if hv.idlePolicy != nil {
+			p := *hv.idlePolicy
+			return &p
+		}
+	}
+	return &def
+}
+
+// apply             把握手时设置的标签,属性及空闲超时策略合并到conf,握手时设置的优先;生成新的map,不修改conf原有的map
+func (hv *handshakeValues) apply(conf *session.ConfigureSession) {
+	tags := make(map[string]string, len(conf.Tags))
+	for k, v := range conf.Tags {
+		tags[k] = v
+	}
+	for k, v := range hv.getTags() {
+		tags[k] = v
+	}
+	conf.Tags = tags
+	values := make(map[string]interface{}, len(conf.Values))
+	for k, v := range conf.Values {
+		values[k] = v
+	}
+	for k, v := range hv.getValues() {
+		values[k] = v
+	}
+	conf.Values = values
+	def := session.IdlePolicy{}
+	if conf.IdlePolicy != nil {
+		def = *conf.IdlePolicy
+	}
+	conf.IdlePolicy = hv.getIdlePolicy(def)
+}
+
+// getHandshakeValues     返回请求Context中的 handshakeValues
+func getHandshakeValues(req *http.Request) *handshakeValues {
+	if req == nil {
+		return nil
+	}
+	hv, _ := req.Context().Value(handshakeValuesKey{}).(*handshakeValues)
+	return hv
+}
+
+// SetHandshakeValue   在握手校验(SetHandshakeCheckHandle,HandshakeHandle,UpgradeOptions.HandshakeHandle)中为即将建立的 Session 设置属性,如认证后的用户信息,链接后可用 Session.Get 获取
+func SetHandshakeValue(req *http.Request, key string, value interface{}) {
+	hv := getHandshakeValues(req)
+	if hv == nil {
+		return
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	hv.values[key] = value
+}
+
+// SetHandshakeTag     在握手校验(SetHandshakeCheckHandle,HandshakeHandle,UpgradeOptions.HandshakeHandle)中为即将建立的 Session 设置标签
+func SetHandshakeTag(req *http.Request, key, value string) {
+	hv := getHandshakeValues(req)
+	if hv == nil || key == "" {
+		return
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	hv.tags[key] = value
+}
+
+// SetHandshakeIdlePolicy     在握手校验中为即将建立的 Session 配置空闲超时策略,覆盖服务端(或 UpgradeOptions.Session)的配置
+func SetHandshakeIdlePolicy(req *http.Request, p IdlePolicy) {
+	hv := getHandshakeValues(req)
+	if hv == nil {
+		return
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	hv.idlePolicy = &p
+}
@@ -0,0 +1,51 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_HandshakeValues(t *testing.T) {
+	server, ts, ids := newTestServer(t, nil)
+	server.SetHandshakeCheckHandle(func(req *http.Request) error {
+		SetHandshakeValue(req, "user", req.Header.Get("X-User"))
+		return nil
+	})
+	server.SetHandshakeHandle(func(req *http.Request, resp *HandshakeResponse) HandshakeDecision {
+		SetHandshakeValue(req, "role", "admin")
+		SetHandshakeTag(req, "user", req.Header.Get("X-User"))
+		SetHandshakeIdlePolicy(req, IdlePolicy{Timeout: time.Minute, CountOutbound: true})
+		return AcceptHandshake()
+	})
+	testDialSession(t, ts, http.Header{"X-User": {"u1"}})
+	sess, err := server.GetSessionOnce(waitTestId(t, ids))
+	if err != nil {
+		t.Fatal("getSessionErr: ", err.Error())
+	}
+	if v, ok := sess.Get("user"); !ok || v != "u1" {
+		t.Fatal("check handle value: ", v, ok)
+	}
+	if v, ok := sess.Get("role"); !ok || v != "admin" {
+		t.Fatal("handshake handle value: ", v, ok)
+	}
+	if v, ok := sess.GetTag("user"); !ok || v != "u1" {
+		t.Fatal("tag: ", v, ok)
+	}
+	if p := sess.GetIdlePolicy(); p.Timeout != time.Minute || !p.CountOutbound {
+		t.Fatalf("idle policy: %+v", p)
+	}
+	h := sess.GetHandshake()
+	if h.Header.Get("X-User") != "u1" || h.URL.Path != "/" || h.ClientIP != "127.0.0.1" || h.RemoteAddr == "" || h.LocalAddr == "" {
+		t.Fatalf("handshake: %+v", h)
+	}
+	// 没有经过握手的请求,设置无效也不会出错
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	SetHandshakeValue(req, "user", "u1")
+	SetHandshakeTag(req, "user", "u1")
+	SetHandshakeIdlePolicy(req, IdlePolicy{Timeout: time.Second})
+	if getHandshakeValues(req) != nil {
+		t.Fatal("values attached to a plain request")
+	}
+}
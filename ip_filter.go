@@ -0,0 +1,53 @@
+package websocket_packet
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// HandshakeReasonIP      ip被拒绝
+const HandshakeReasonIP = "ip"
+
+// ipFilter      ip的黑白名单,可以在运行时重新加载
+type ipFilter struct {
+	mu    sync.RWMutex
+	allow ipNets
+	deny  ipNets
+}
+
+// set           重新加载黑白名单
+func (f *ipFilter) set(allow, deny []string) error {
+	allowNets, err := parseIPNets(allow...)
+	if err != nil {
+		return err
+	}
+	denyNets, err := parseIPNets(deny...)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.allow, f.deny = allowNets, denyNets
+	return nil
+}
+
+/*
+check             校验ip
+  - remote        直连ip,在黑名单中时拒绝
+  - client        客户端ip(来自受信任的代理时为转发的ip),在黑名单中,或白名单不为空且不在白名单中时拒绝
+*/
+func (f *ipFilter) check(remote, client net.IP) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return nil
+	}
+	if f.deny.contains(remote) || f.deny.contains(client) {
+		return &HandshakeError{Status: http.StatusForbidden, Body: "ip denied", Reason: HandshakeReasonIP}
+	}
+	if len(f.allow) > 0 && !f.allow.contains(client) {
+		return &HandshakeError{Status: http.StatusForbidden, Body: "ip not allowed", Reason: HandshakeReasonIP}
+	}
+	return nil
+}
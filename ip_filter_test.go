@@ -0,0 +1,61 @@
+package websocket_packet
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func Test_IPFilter(t *testing.T) {
+	f := &ipFilter{}
+	if err := f.check(net.ParseIP("1.2.3.4"), net.ParseIP("1.2.3.4")); err != nil {
+		t.Fatal("empty filter: ", err.Error())
+	}
+	if err := f.set([]string{"5.5.5.0/24", "2001:db8::/32"}, []string{"5.5.5.5", "10.0.0.1"}); err != nil {
+		t.Fatal("setErr: ", err.Error())
+	}
+	cases := []struct {
+		name   string
+		remote string
+		client string
+		ok     bool
+	}{
+		{"allowed", "5.5.5.1", "5.5.5.1", true},
+		{"allowed ipv6", "2001:db8::1", "2001:db8::1", true},
+		{"not allowed", "6.6.6.6", "6.6.6.6", false},
+		{"denied inside allowed", "5.5.5.5", "5.5.5.5", false},
+		{"allowed through proxy", "10.0.0.2", "5.5.5.1", true},
+		{"denied proxy", "10.0.0.1", "5.5.5.1", false},
+		{"denied client through proxy", "10.0.0.2", "5.5.5.5", false},
+		{"allow list checks the client", "5.5.5.1", "6.6.6.6", false},
+		{"unparsed client", "5.5.5.1", "", false},
+	}
+	for _, c := range cases {
+		err := f.check(net.ParseIP(c.remote), net.ParseIP(c.client))
+		if (err == nil) != c.ok {
+			t.Fatalf("%s: err %v", c.name, err)
+		}
+		if err != nil {
+			if he := toHandshakeError(err, ""); he.Status != http.StatusForbidden || he.Reason != HandshakeReasonIP {
+				t.Fatalf("%s: status %d reason %s", c.name, he.Status, he.Reason)
+			}
+		}
+	}
+	// 重新加载:只有黑名单时其它ip都允许
+	if err := f.set(nil, []string{"6.6.6.0/24"}); err != nil {
+		t.Fatal("setErr: ", err.Error())
+	}
+	if err := f.check(net.ParseIP("7.7.7.7"), net.ParseIP("7.7.7.7")); err != nil {
+		t.Fatal("after reload: ", err.Error())
+	}
+	if err := f.check(net.ParseIP("6.6.6.6"), net.ParseIP("6.6.6.6")); err == nil {
+		t.Fatal("denied after reload")
+	}
+	// 加载失败时保留原来的配置
+	if err := f.set([]string{"bad"}, nil); err == nil {
+		t.Fatal("bad cidr should fail")
+	}
+	if err := f.check(net.ParseIP("6.6.6.6"), net.ParseIP("6.6.6.6")); err == nil {
+		t.Fatal("failed set should keep the previous filter")
+	}
+}
@@ -0,0 +1,270 @@
+package websocket_packet
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LimitPolicy       超过链接数限制时的处理策略
+type LimitPolicy int
+
+const (
+	LimitReject      LimitPolicy = iota // 拒绝新的握手(默认)
+	LimitEvictOldest                    // 断开最早建立的session,接受新的握手
+)
+
+// HandshakeReasonLimit     超过链接数限制
+const HandshakeReasonLimit = "limit"
+
+/*
+ConnectionLimits             链接数限制,<1为不限制
+  - MaxSessions              session总数,超过时拒绝回复503
+  - MaxPerIP                 每个客户端ip的session数,超过时拒绝回复429;客户端ip见 SetTrustedProxies
+  - MaxPerTag                每个标签值的session数,如: {"user": 3} 表示每个用户最多3个session,超过时拒绝回复429
+  - Policy                   超过限制时的处理策略
+  - RetryAfter               拒绝时回复的 Retry-After(秒),<1时不回复
+*/
+type ConnectionLimits struct {
+	MaxSessions int
+	MaxPerIP    int
+	MaxPerTag   map[string]int
+	Policy      LimitPolicy
+	RetryAfter  int64
+}
+
+// limitEntry       登记的session
+type limitEntry struct {
+	ip   string
+	nano int64
+}
+
+// limitTicket      通过限制校验的握手,session加入管理器后 commit,握手失败时 release;evict 中的session在 commit 时移除,release 时保留
+type limitTicket struct {
+	l     *connLimiter
+	ip    string
+	tags  map[string]string
+	evict []int64
+	once  sync.Once
+}
+
+// release          释放预留的名额
+func (t *limitTicket) release() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		t.l.mu.Lock()
+		defer t.l.mu.Unlock()
+		t.l.unreserve(t)
+		for _, id := range t.evict {
+			delete(t.l.evicting, id)
+		}
+	})
+}
+
+// commit           登记session,并释放预留的名额
+func (t *limitTicket) commit(id int64) {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		t.l.mu.Lock()
+		defer t.l.mu.Unlock()
+		t.l.unreserve(t)
+		for _, evict := range t.evict {
+			t.l.forget(evict)
+		}
+		t.l.sessions[id] = limitEntry{ip: t.ip, nano: time.Now().UnixNano()}
+		ids, ok := t.l.ips[t.ip]
+		if !ok {
+			ids = map[int64]struct{}{}
+			t.l.ips[t.ip] = ids
+		}
+		ids[id] = struct{}{}
+	})
+}
+
+// connLimiter       链接数限制
+type connLimiter struct {
+	mu          sync.Mutex
+	limits      ConnectionLimits
+	tags        *tagIndex
+	sessions    map[int64]limitEntry
+	ips         map[string]map[int64]struct{}
+	evicting    map[int64]struct{} // 已被握手选中淘汰,等待 commit 的session,不计入限制,也不会被再次选中
+	pending     int
+	pendingIPs  map[string]int
+	pendingTags map[string]int
+}
+
+func newConnLimiter(tags *tagIndex) *connLimiter {
+	return &connLimiter{
+		tags:        tags,
+		sessions:    map[int64]limitEntry{},
+		ips:         map[string]map[int64]struct{}{},
+		evicting:    map[int64]struct{}{},
+		pendingIPs:  map[string]int{},
+		pendingTags: map[string]int{},
+	}
+}
+
+func (l *connLimiter) setLimits(limits ConnectionLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+func tagPendingKey(key, value string) string {
+	return key + "\x00" + value
+}
+
+// unregister       session移除时执行
+func (l *connLimiter) unregister(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.forget(id)
+}
+
+// forget           需在锁内执行
+func (l *connLimiter) forget(id int64) {
+	entry, ok := l.sessions[id]
+	if !ok {
+		return
+	}
+	delete(l.sessions, id)
+	delete(l.evicting, id)
+	ids := l.ips[entry.ip]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(l.ips, entry.ip)
+	}
+}
+
+// unreserve        需在锁内执行
+func (l *connLimiter) unreserve(t *limitTicket) {
+	l.pending--
+	if l.pendingIPs[t.ip]--; l.pendingIPs[t.ip] <= 0 {
+		delete(l.pendingIPs, t.ip)
+	}
+	for key, value := range t.tags {
+		k := tagPendingKey(key, value)
+		if l.pendingTags[k]--; l.pendingTags[k] <= 0 {
+			delete(l.pendingTags, k)
+		}
+	}
+}
+
+// active           返回列表中未被选中淘汰的session数,需在锁内执行
+func (l *connLimiter) active(ids map[int64]struct{}) int {
+	n := len(ids)
+	for id := range l.evicting {
+		if _, ok := ids[id]; ok {
+			n--
+		}
+	}
+	return n
+}
+
+// oldest           返回列表中最早登记的session,需在锁内执行
+func (l *connLimiter) oldest(ids map[int64]struct{}) (int64, bool) {
+	var id, nano int64
+	var found bool
+	for i := range ids {
+		entry, ok := l.sessions[i]
+		if !ok {
+			continue
+		}
+		if !found || entry.nano < nano {
+			id, nano, found = i, entry.nano, true
+		}
+	}
+	return id, found
+}
+
+// admit            检查一组session是否超过限制,超过时按策略选出淘汰的session(追加到evict)或返回错误,需在锁内执行;选出的session在所有检查通过后才移除
+func (l *connLimiter) admit(count, pending, max, status int, name string, getIds func() map[int64]struct{}, evict *[]int64) error {
+	if max < 1 || count+pending < max {
+		return nil
+	}
+	err := NewRetryAfterError(status, l.limits.RetryAfter, fmt.Sprintf("too many connections(%s)", name))
+	if l.limits.Policy != LimitEvictOldest {
+		return err
+	}
+	ids := getIds()
+	for id := range l.evicting {
+		delete(ids, id)
+	}
+	for _, id := range *evict {
+		delete(ids, id)
+	}
+	for len(ids)+pending >= max {
+		id, ok := l.oldest(ids)
+		if !ok {
+			return err
+		}
+		delete(ids, id)
+		*evict = append(*evict, id)
+	}
+	return nil
+}
+
+// reserve          校验链接数限制,并预留一个名额
+func (l *connLimiter) reserve(ip string, tags map[string]string) (*limitTicket, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var evict []int64
+	err := l.admit(len(l.sessions)-len(l.evicting), l.pending, l.limits.MaxSessions, http.StatusServiceUnavailable, "server", func() map[int64]struct{} {
+		ids := make(map[int64]struct{}, len(l.sessions))
+		for id := range l.sessions {
+			ids[id] = struct{}{}
+		}
+		return ids
+	}, &evict)
+	if err == nil {
+		err = l.admit(l.active(l.ips[ip]), l.pendingIPs[ip], l.limits.MaxPerIP, http.StatusTooManyRequests, "ip", func() map[int64]struct{} {
+			ids := make(map[int64]struct{}, len(l.ips[ip]))
+			for id := range l.ips[ip] {
+				ids[id] = struct{}{}
+			}
+			return ids
+		}, &evict)
+	}
+	for key, max := range l.limits.MaxPerTag {
+		if err != nil {
+			break
+		}
+		value, ok := tags[key]
+		if !ok || value == "" {
+			continue
+		}
+		ids := map[int64]struct{}{}
+		for _, id := range l.tags.find(key, value) {
+			if _, ok := l.sessions[id]; ok {
+				ids[id] = struct{}{}
+			}
+		}
+		err = l.admit(l.active(ids), l.pendingTags[tagPendingKey(key, value)], max, http.StatusTooManyRequests, key, func() map[int64]struct{} {
+			return ids
+		}, &evict)
+	}
+	if err != nil {
+		he := toHandshakeError(err, HandshakeReasonLimit)
+		he.Reason = HandshakeReasonLimit
+		return nil, he
+	}
+	t := &limitTicket{l: l, ip: ip, tags: map[string]string{}, evict: evict}
+	for _, id := range evict {
+		l.evicting[id] = struct{}{}
+	}
+	l.pending++
+	l.pendingIPs[ip]++
+	for key := range l.limits.MaxPerTag {
+		if value, ok := tags[key]; ok && value != "" {
+			t.tags[key] = value
+			l.pendingTags[tagPendingKey(key, value)]++
+		}
+	}
+	return t, nil
+}
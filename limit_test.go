@@ -0,0 +1,101 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"testing"
+)
+
+// testReserve      预留一个名额,err不为nil时返回其状态码
+func testReserve(l *connLimiter, ip string, tags map[string]string) (*limitTicket, int) {
+	t, err := l.reserve(ip, tags)
+	if err != nil {
+		return nil, toHandshakeError(err, "").Status
+	}
+	return t, 0
+}
+
+func Test_LimitReject(t *testing.T) {
+	tags := newTagIndex()
+	l := newConnLimiter(tags)
+	l.setLimits(ConnectionLimits{MaxSessions: 3, MaxPerIP: 2, MaxPerTag: map[string]int{"user": 1}, RetryAfter: 5})
+	t1, _ := testReserve(l, "1.1.1.1", nil)
+	t1.commit(1)
+	// 预留中的握手也计入限制
+	t2, _ := testReserve(l, "1.1.1.1", nil)
+	if _, status := testReserve(l, "1.1.1.1", nil); status != http.StatusTooManyRequests {
+		t.Fatal("per ip status: ", status)
+	}
+	t2.release()
+	t2, _ = testReserve(l, "1.1.1.1", nil)
+	t2.commit(2)
+	t3, _ := testReserve(l, "2.2.2.2", map[string]string{"user": "u1"})
+	tags.register(3, map[string]string{"user": "u1"})
+	t3.commit(3)
+	if _, status := testReserve(l, "3.3.3.3", map[string]string{"user": "u2"}); status != http.StatusServiceUnavailable {
+		t.Fatal("server status: ", status)
+	}
+	l.unregister(1)
+	_, err := l.reserve("3.3.3.3", map[string]string{"user": "u1"})
+	he := toHandshakeError(err, "")
+	if he.Status != http.StatusTooManyRequests || he.Reason != HandshakeReasonLimit || he.Header.Get("Retry-After") != "5" {
+		t.Fatal("per tag error: ", err)
+	}
+	if _, status := testReserve(l, "3.3.3.3", map[string]string{"user": "u2"}); status != 0 {
+		t.Fatal("status: ", status)
+	}
+}
+
+func Test_LimitEvictOldest(t *testing.T) {
+	l := newConnLimiter(newTagIndex())
+	l.setLimits(ConnectionLimits{MaxSessions: 2, Policy: LimitEvictOldest})
+	for id := int64(1); id <= 2; id++ {
+		ticket, _ := testReserve(l, "1.1.1.1", nil)
+		ticket.commit(id)
+	}
+	t3, _ := testReserve(l, "2.2.2.2", nil)
+	if len(t3.evict) != 1 || t3.evict[0] != 1 {
+		t.Fatal("evict: ", t3.evict)
+	}
+	// 选中淘汰的session不会被并发的握手再次选中
+	t4, _ := testReserve(l, "2.2.2.2", nil)
+	if len(t4.evict) != 1 || t4.evict[0] != 2 {
+		t.Fatal("evict: ", t4.evict)
+	}
+	t3.commit(3)
+	t4.commit(4)
+	if len(l.sessions) != 2 || len(l.evicting) != 0 || len(l.ips["1.1.1.1"]) != 0 {
+		t.Fatal("sessions: ", l.sessions, " evicting: ", l.evicting)
+	}
+}
+
+func Test_LimitEvictRollback(t *testing.T) {
+	l := newConnLimiter(newTagIndex())
+	l.setLimits(ConnectionLimits{MaxSessions: 2, MaxPerIP: 1, Policy: LimitEvictOldest})
+	t1, _ := testReserve(l, "1.1.1.1", nil)
+	t1.commit(1)
+	t2, _ := testReserve(l, "2.2.2.2", nil)
+	t2.commit(2)
+	// 3.3.3.3 只有预留中的握手,没有可以淘汰的session;之前选中的淘汰不能生效
+	pending, _ := testReserve(l, "3.3.3.3", nil)
+	if _, status := testReserve(l, "3.3.3.3", nil); status != http.StatusTooManyRequests {
+		t.Fatal("status: ", status)
+	}
+	if _, ok := l.evicting[2]; len(l.sessions) != 2 || ok {
+		t.Fatal("sessions: ", l.sessions, " evicting: ", l.evicting)
+	}
+	// 握手失败时,选中淘汰的session仍然计入限制
+	pending.release()
+	if len(pending.evict) != 1 || len(l.sessions) != 2 || len(l.evicting) != 0 {
+		t.Fatal("evict: ", pending.evict, " sessions: ", l.sessions, " evicting: ", l.evicting)
+	}
+	t5, _ := testReserve(l, "5.5.5.5", nil)
+	if len(t5.evict) != 1 || t5.evict[0] != 1 {
+		t.Fatal("evict: ", t5.evict)
+	}
+	// 选中淘汰的session在 commit 之前断开
+	l.unregister(1)
+	t5.commit(5)
+	if len(l.sessions) != 2 || len(l.evicting) != 0 {
+		t.Fatal("sessions: ", l.sessions, " evicting: ", l.evicting)
+	}
+}
@@ -0,0 +1,98 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+OriginPolicy                 握手时对 Origin 请求头的校验策略,防止跨站的websocket劫持
+  - 请求没有 Origin 时(非浏览器客户端)默认通过,AllowEmpty 为false时拒绝
+  - Origin 的host与请求的 Host 相同时(同源)总是通过
+  - 未配置策略时使用默认的同源策略,跨源的浏览器请求会被拒绝(403);之前的版本不校验 Origin,需要保持原来的行为时配置 &OriginPolicy{AllowAll: true}
+  - AllowedOrigins           允许的Origin列表,如: https://a.com, https://*.a.com, *.a.com(不限scheme), a.com:8080;*.a.com 只匹配子域名,不匹配 a.com;没有端口时匹配任意端口
+  - AllowAll                 允许所有的Origin
+  - CheckHandle              自定义校验,配置后忽略其它配置
+*/
+type OriginPolicy struct {
+	AllowedOrigins []string
+	AllowAll       bool
+	AllowEmpty     bool
+	CheckHandle    func(origin string, req *http.Request) bool
+}
+
+// NewOriginPolicy     生成一个默认的同源策略,allowedOrigins为额外允许的Origin
+func NewOriginPolicy(allowedOrigins ...string) *OriginPolicy {
+	return &OriginPolicy{
+		AllowedOrigins: allowedOrigins,
+		AllowEmpty:     true,
+	}
+}
+
+// Check           校验请求的 Origin
+func (p *OriginPolicy) Check(req *http.Request) bool {
+	if p == nil {
+		p = NewOriginPolicy()
+	}
+	origin := req.Header.Get("Origin")
+	if p.CheckHandle != nil {
+		return p.CheckHandle(origin, req)
+	}
+	if p.AllowAll {
+		return true
+	}
+	if origin == "" {
+		return p.AllowEmpty
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	for _, pattern := range p.AllowedOrigins {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin      Origin是否匹配允许的模式
+func matchOrigin(pattern string, origin *url.URL) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	if i := strings.Index(pattern, "://"); i != -1 {
+		if pattern[:i] != strings.ToLower(origin.Scheme) {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	host := strings.ToLower(origin.Host)
+	patternHost, patternPort := splitHostPort(pattern)
+	originHost, originPort := splitHostPort(host)
+	if patternPort != "" && patternPort != originPort {
+		return false
+	}
+	if strings.HasPrefix(patternHost, "*.") {
+		return strings.HasSuffix(originHost, patternHost[1:])
+	}
+	return patternHost == originHost
+}
+
+// splitHostPort     拆分host与端口,没有端口时返回空字符串
+func splitHostPort(hostPort string) (string, string) {
+	i := strings.LastIndex(hostPort, ":")
+	if i == -1 || strings.HasSuffix(hostPort, "]") {
+		return hostPort, ""
+	}
+	return hostPort[:i], hostPort[i+1:]
+}
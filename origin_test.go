@@ -0,0 +1,84 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func Test_MatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://any.com", true},
+		{"", "https://a.com", false},
+		{"https://a.com", "https://a.com", true},
+		{"https://a.com/", "https://A.com", true},
+		{"https://a.com", "http://a.com", false},
+		{"a.com", "http://a.com", true},
+		{"a.com", "https://a.com:8443", true},
+		{"a.com", "https://b.com", false},
+		{"a.com", "https://sub.a.com", false},
+		{"*.a.com", "https://sub.a.com", true},
+		{"*.a.com", "http://x.sub.a.com", true},
+		{"*.a.com", "https://a.com", false},
+		{"*.a.com", "https://evila.com", false},
+		{"*.a.com", "https://a.com.evil.com", false},
+		{"https://*.a.com", "http://sub.a.com", false},
+		{"https://*.a.com:8443", "https://sub.a.com:8443", true},
+		{"https://*.a.com:8443", "https://sub.a.com", false},
+		{"a.com:8080", "http://a.com:8080", true},
+		{"a.com:8080", "http://a.com:8081", false},
+		{"a.com:8080", "http://a.com", false},
+		{"[::1]:8080", "http://[::1]:8080", true},
+		{"[::1]", "http://[::1]:8080", true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.origin)
+		if err != nil {
+			t.Fatal("parseErr: ", err.Error())
+		}
+		if got := matchOrigin(c.pattern, u); got != c.want {
+			t.Fatalf("pattern %q origin %q: got %v", c.pattern, c.origin, got)
+		}
+	}
+}
+
+func Test_OriginPolicyCheck(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy *OriginPolicy
+		origin string
+		want   bool
+	}{
+		{"default no origin", nil, "", true},
+		{"default same origin", nil, "https://example.com:8080", true},
+		{"default same origin ignores case", nil, "https://EXAMPLE.com:8080", true},
+		{"default cross origin", nil, "https://other.com", false},
+		{"default other port", nil, "https://example.com:9090", false},
+		{"default bad origin", nil, "null", false},
+		{"allowed origin", NewOriginPolicy("*.other.com"), "https://app.other.com", true},
+		{"not in allowed", NewOriginPolicy("*.other.com"), "https://app.evil.com", false},
+		{"allow all", &OriginPolicy{AllowAll: true}, "https://other.com", true},
+		{"reject empty", &OriginPolicy{}, "", false},
+		{"zero policy same origin", &OriginPolicy{}, "https://example.com:8080", true},
+		{"check handle", &OriginPolicy{
+			AllowAll: true,
+			CheckHandle: func(origin string, req *http.Request) bool {
+				return origin == "https://trusted.com"
+			},
+		}, "https://other.com", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com:8080/ws", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if got := c.policy.Check(req); got != c.want {
+			t.Fatalf("%s: got %v", c.name, got)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package websocket_packet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// 在线状态事件类型
+const (
+	PresenceOnline  = "online"  // 用户的第一个session上线
+	PresenceOffline = "offline" // 用户的最后一个session下线
+	PresenceJoin    = "join"    // 用户(第一个session)加入房间
+	PresenceLeave   = "leave"   // 用户(最后一个session)离开房间
+)
+
+/*
+PresenceEvent         在线状态事件
+  - Type              事件类型:online,offline,join,leave
+  - UserId            用户id
+  - Room              房间,只有join,leave事件有值
+  - SessionId         触发事件的sessionId
+  - Sessions          事件发生后用户(在房间内)的session数
+*/
+type PresenceEvent struct {
+	Type      string `json:"type"`
+	UserId    string `json:"user_id"`
+	Room      string `json:"room,omitempty"`
+	SessionId int64  `json:"session_id"`
+	Sessions  int    `json:"sessions"`
+}
+
+/*
+PresenceInterface      在线状态管理,基于session的链接与断开
+  - session需要先 Bind 到一个用户后,才会计入在线状态与房间
+  - session断开后,会自动离开所有房间并解除与用户的关联
+*/
+type PresenceInterface interface {
+	Bind(id int64, userId string) error       // session关联到用户
+	Unbind(id int64)                          // 解除session与用户的关联,并离开所有房间
+	JoinRoom(id int64, rooms ...string) error // session加入房间
+	LeaveRoom(id int64, rooms ...string)      // session离开房间
+	GetUserId(id int64) (string, bool)        // 返回session关联的用户
+	IsOnline(userId string) bool              // 用户是否在线
+	UserSessions(userId string) []int64       // 返回用户的session列表
+	OnlineUsers() []string                    // 返回在线的用户列表
+	RoomUsers(room string) []string           // 返回房间内的用户列表
+	UserRooms(userId string) []string         // 返回用户所在的房间列表
+	SetEventCallBack(f func(e PresenceEvent)) // 配置在线状态事件的回调
+	SetRoomNotify(b bool)                     // join,leave事件是否以文本帧(json)发送给房间成员,默认为false
+}
+
+func newPresence(server ServerHandlerInterface) *presence {
+	return &presence{
+		server:       server,
+		sessionUser:  map[int64]string{},
+		userSessions: map[string]map[int64]struct{}{},
+		sessionRooms: map[int64]map[string]struct{}{},
+		roomUsers:    map[string]map[string]int{},
+	}
+}
+
+type presence struct {
+	mu           sync.RWMutex
+	server       ServerHandlerInterface
+	sessionUser  map[int64]string              // session -> 用户
+	userSessions map[string]map[int64]struct{} // 用户 -> session
+	sessionRooms map[int64]map[string]struct{} // session -> 房间
+	roomUsers    map[string]map[string]int     // 房间 -> 用户 -> 在房间内的session数
+	eventCb      func(e PresenceEvent)
+	isRoomNotify bool
+	events       []PresenceEvent // 待发送的事件,按产生的顺序排列
+	emitting     bool            // 是否有发送事件的goroutine
+}
+
+func (p *presence) Bind(id int64, userId string) error {
+	if userId == "" {
+		return errors.New("userId is empty")
+	}
+	var events []PresenceEvent
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 在锁内确认session未断开:断开时先从管理器移除,再执行 Unbind,Unbind 会在这里之后执行
+	if _, err := p.server.GetSessionOnce(id); err != nil {
+		return err
+	}
+	if old, ok := p.sessionUser[id]; ok {
+		if old == userId {
+			return nil
+		}
+		events = p.unbind(id)
+	}
+	p.sessionUser[id] = userId
+	set, ok := p.userSessions[userId]
+	if !ok {
+		set = map[int64]struct{}{}
+		p.userSessions[userId] = set
+	}
+	set[id] = struct{}{}
+	if len(set) == 1 {
+		events = append(events, PresenceEvent{Type: PresenceOnline, UserId: userId, SessionId: id, Sessions: 1})
+	}
+	p.emit(events)
+	return nil
+}
+
+func (p *presence) Unbind(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(p.unbind(id))
+}
+
+// unbind         解除关联,需在锁内执行
+func (p *presence) unbind(id int64) []PresenceEvent {
+	userId, ok := p.sessionUser[id]
+	if !ok {
+		return nil
+	}
+	var events []PresenceEvent
+	for room := range p.sessionRooms[id] {
+		if e, ok := p.leaveRoom(id, userId, room); ok {
+			events = append(events, e)
+		}
+	}
+	delete(p.sessionRooms, id)
+	delete(p.sessionUser, id)
+	set := p.userSessions[userId]
+	delete(set, id)
+	if len(set) == 0 {
+		delete(p.userSessions, userId)
+		events = append(events, PresenceEvent{Type: PresenceOffline, UserId: userId, SessionId: id})
+	}
+	return events
+}
+
+func (p *presence) JoinRoom(id int64, rooms ...string) error {
+	var events []PresenceEvent
+	p.mu.Lock()
+	userId, ok := p.sessionUser[id]
+	if !ok {
+		p.mu.Unlock()
+		return errors.New(fmt.Sprintf("session(%d) is not bound to a user", id))
+	}
+	set, ok := p.sessionRooms[id]
+	if !ok {
+		set = map[string]struct{}{}
+		p.sessionRooms[id] = set
+	}
+	for _, room := range rooms {
+		if room == "" {
+			continue
+		}
+		if _, ok := set[room]; ok {
+			continue
+		}
+		set[room] = struct{}{}
+		users, ok := p.roomUsers[room]
+		if !ok {
+			users = map[string]int{}
+			p.roomUsers[room] = users
+		}
+		users[userId]++
+		if users[userId] == 1 {
+			events = append(events, PresenceEvent{Type: PresenceJoin, UserId: userId, Room: room, SessionId: id, Sessions: 1})
+		}
+	}
+	p.emit(events)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *presence) LeaveRoom(id int64, rooms ...string) {
+	var events []PresenceEvent
+	p.mu.Lock()
+	userId, ok := p.sessionUser[id]
+	if ok {
+		for _, room := range rooms {
+			if e, ok := p.leaveRoom(id, userId, room); ok {
+				events = append(events, e)
+			}
+		}
+	}
+	p.emit(events)
+	p.mu.Unlock()
+}
+
+// leaveRoom       session离开房间,需在锁内执行;用户最后一个session离开时返回leave事件
+func (p *presence) leaveRoom(id int64, userId, room string) (PresenceEvent, bool) {
+	set := p.sessionRooms[id]
+	if _, ok := set[room]; !ok {
+		return PresenceEvent{}, false
+	}
+	delete(set, room)
+	users := p.roomUsers[room]
+	users[userId]--
+	if users[userId] > 0 {
+		return PresenceEvent{}, false
+	}
+	delete(users, userId)
+	if len(users) == 0 {
+		delete(p.roomUsers, room)
+	}
+	return PresenceEvent{Type: PresenceLeave, UserId: userId, Room: room, SessionId: id}, true
+}
+
+func (p *presence) GetUserId(id int64) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	userId, ok := p.sessionUser[id]
+	return userId, ok
+}
+
+func (p *presence) IsOnline(userId string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.userSessions[userId]
+	return ok
+}
+
+func (p *presence) UserSessions(userId string) []int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var ids []int64
+	for id := range p.userSessions[userId] {
+		ids = append(ids, id)
+	}
+	sort.Sort(itemKeys(ids))
+	return ids
+}
+
+func (p *presence) OnlineUsers() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var list []string
+	for userId := range p.userSessions {
+		list = append(list, userId)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (p *presence) RoomUsers(room string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var list []string
+	for userId := range p.roomUsers[room] {
+		list = append(list, userId)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (p *presence) UserRooms(userId string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var list []string
+	for room, users := range p.roomUsers {
+		if _, ok := users[userId]; ok {
+			list = append(list, room)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (p *presence) SetEventCallBack(f func(e PresenceEvent)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eventCb = f
+}
+
+func (p *presence) SetRoomNotify(b bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.isRoomNotify = b
+}
+
+// emit         事件按产生的顺序加入队列,由一个goroutine依次发送:回调,及房间通知;需在锁内执行
+func (p *presence) emit(events []PresenceEvent) {
+	if len(events) == 0 || (p.eventCb == nil && !p.isRoomNotify) {
+		return
+	}
+	p.events = append(p.events, events...)
+	if !p.emitting {
+		p.emitting = true
+		go p.drain()
+	}
+}
+
+// drain        依次发送队列中的事件,队列为空时退出
+func (p *presence) drain() {
+	for {
+		p.mu.Lock()
+		events, cb, isRoomNotify := p.events, p.eventCb, p.isRoomNotify
+		p.events = nil
+		if len(events) == 0 {
+			p.emitting = false
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+		for _, e := range events {
+			if cb != nil {
+				cb(e)
+			}
+			if isRoomNotify && e.Room != "" {
+				p.notifyRoom(e)
+			}
+		}
+	}
+}
+
+// notifyRoom     发送join,leave事件给房间内所有session
+func (p *presence) notifyRoom(e PresenceEvent) {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	var ids []int64
+	p.mu.RLock()
+	for userId := range p.roomUsers[e.Room] {
+		for id := range p.userSessions[userId] {
+			if _, ok := p.sessionRooms[id][e.Room]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	p.mu.RUnlock()
+	for _, id := range ids {
+		p.server.SendMessage(id, 1, bs)
+	}
+}
+
+func (p *presence) onConnected(id int64, req *http.Request) {}
+
+func (p *presence) onDisConnected(id int64) {
+	p.Unbind(id)
+}
+
+func (p *presence) onMessage(id int64, t byte, payload []byte) bool {
+	return false
+}
@@ -0,0 +1,68 @@
+package websocket_packet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPresenceServer     只实现 GetSessionOnce 的管理器,live中的session视为在线
+type testPresenceServer struct {
+	ServerHandlerInterface
+	mu   sync.Mutex
+	live map[int64]bool
+}
+
+func (s *testPresenceServer) GetSessionOnce(id int64) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.live[id] {
+		return nil, errors.New("not found")
+	}
+	return nil, nil
+}
+
+func Test_PresenceEventOrder(t *testing.T) {
+	p := newPresence(&testPresenceServer{live: map[int64]bool{1: true}})
+	events := make(chan PresenceEvent, 1000)
+	p.SetEventCallBack(func(e PresenceEvent) {
+		events <- e
+	})
+	for i := 0; i < 200; i++ {
+		if err := p.Bind(1, "u1"); err != nil {
+			t.Fatal("bindErr: ", err.Error())
+		}
+		p.Unbind(1)
+	}
+	for i := 0; i < 400; i++ {
+		want := PresenceOnline
+		if i%2 == 1 {
+			want = PresenceOffline
+		}
+		select {
+		case e := <-events:
+			if e.Type != want {
+				t.Fatalf("event %d: got %s, want %s", i, e.Type, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("event timeout: ", i)
+		}
+	}
+}
+
+func Test_PresenceBindClosed(t *testing.T) {
+	server := &testPresenceServer{live: map[int64]bool{1: true}}
+	p := newPresence(server)
+	// 断开的session:先从管理器移除,再执行 onDisConnected
+	server.mu.Lock()
+	delete(server.live, 1)
+	server.mu.Unlock()
+	p.onDisConnected(1)
+	if err := p.Bind(1, "u1"); err == nil {
+		t.Fatal("bind closed session should fail")
+	}
+	if p.IsOnline("u1") {
+		t.Fatal("closed session online")
+	}
+}
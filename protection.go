@@ -0,0 +1,100 @@
+package websocket_packet
+
+import (
+	"context"
+	"github.com/qdmc/websocket_packet/session"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HandshakeReasonPending     等待中的握手过多
+const HandshakeReasonPending = "pending"
+
+/*
+ConnProtection                  链接保护,防止慢速攻击(slow-loris)
+  - FirstFrameTimeout           从TCP accept到读取到第一个完整帧的最长时间,<=0:不限制
+  - MaxPendingHandshakes        等待中的握手(开始握手,到读取到第一个完整帧)的最大数量,超过时拒绝回复503,<1:不限制
+  - FrameReadTimeout            帧开始后(包括负载),每次读取的最长等待,<=0:不限制
+  - MinReadRate                 帧头的最低读取速率(字节/秒),<1:不限制;负载只受 FrameReadTimeout 限制
+  - 只有配置了 http.Server.ConnContext = ConnContext 时才能获取TCP accept的时间,否则从开始握手计算
+*/
+type ConnProtection struct {
+	FirstFrameTimeout    time.Duration
+	MaxPendingHandshakes int64
+	FrameReadTimeout     time.Duration
+	MinReadRate          int64
+}
+
+type acceptTimeKey struct{}
+
+// ConnContext      用于 http.Server.ConnContext,记录TCP accept的时间
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, acceptTimeKey{}, time.Now())
+}
+
+// acceptTime       返回TCP accept的时间,没有记录时返回当前时间
+func acceptTime(req *http.Request) time.Time {
+	if t, ok := req.Context().Value(acceptTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// connProtection      链接保护的状态
+type connProtection struct {
+	mu      sync.RWMutex
+	p       ConnProtection
+	pending int64
+}
+
+func (c *connProtection) set(p ConnProtection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.p = p
+}
+
+func (c *connProtection) get() ConnProtection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.p
+}
+
+// acquire          登记一个等待中的握手,返回释放的方法;超过最大数量时返回错误
+func (c *connProtection) acquire() (func(), error) {
+	max := c.get().MaxPendingHandshakes
+	n := atomic.AddInt64(&c.pending, 1)
+	if max > 0 && n > max {
+		atomic.AddInt64(&c.pending, -1)
+		he := NewRetryAfterError(http.StatusServiceUnavailable, 1, "too many pending handshakes")
+		he.Reason = HandshakeReasonPending
+		return func() {}, he
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&c.pending, -1)
+		})
+	}, nil
+}
+
+// getPending       返回等待中的握手数
+func (c *connProtection) getPending() int64 {
+	return atomic.LoadInt64(&c.pending)
+}
+
+// readProtection   生成session的读取保护
+func (c *connProtection) readProtection(req *http.Request, release func()) *session.ReadProtection {
+	p := c.get()
+	rp := &session.ReadProtection{
+		FrameReadTimeout:   p.FrameReadTimeout,
+		MinReadRate:        p.MinReadRate,
+		FirstFrameCallBack: release,
+	}
+	if p.FirstFrameTimeout > 0 {
+		rp.FirstFrameDeadline = acceptTime(req).Add(p.FirstFrameTimeout)
+	}
+	return rp
+}
@@ -0,0 +1,182 @@
+package websocket_packet
+
+import (
+	"errors"
+	"github.com/qdmc/websocket_packet/session"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDialHandshake      以 ClientHandshake 链接ts,返回 Session
+func testDialHandshake(t *testing.T, ts *httptest.Server) (Session, error) {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("dialErr: ", err.Error())
+	}
+	sess, _, err := ClientHandshake(conn, "ws"+strings.TrimPrefix(ts.URL, "http"), ClientHandshakeOptions{Timeout: time.Second})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.Cleanup(func() { conn.Close() })
+	return sess, nil
+}
+
+// testDialSession        以 ClientHandshake 链接ts并开始读取,收到的数据帧发送到返回的通道
+func testDialSession(t *testing.T, ts *httptest.Server, header http.Header) (Session, chan []byte) {
+	msgs := make(chan []byte, 16)
+	sess := testDialConfig(t, ts, header, &session.ConfigureSession{
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) {
+			msgs <- payload
+		},
+	})
+	return sess, msgs
+}
+
+// testDialConfig         以 ClientHandshake 及conf链接ts并开始读取
+func testDialConfig(t *testing.T, ts *httptest.Server, header http.Header, conf *session.ConfigureSession) Session {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("dialErr: ", err.Error())
+	}
+	t.Cleanup(func() { conn.Close() })
+	sess, _, err := ClientHandshake(conn, "ws"+strings.TrimPrefix(ts.URL, "http"), ClientHandshakeOptions{
+		Header:  header,
+		Timeout: time.Second,
+		Session: conf,
+	})
+	if err != nil {
+		t.Fatal("handshakeErr: ", err.Error())
+	}
+	go sess.DoConnect()
+	return sess
+}
+
+// newTestServer          重置全局的管理器并启动测试服务,建立的(服务端)sessionId发送到返回的通道
+func newTestServer(t *testing.T, cbs *CallbackHandles) (ServerHandlerInterface, *httptest.Server, chan int64) {
+	server := NewServerHandle()
+	resetTestServer(t, server)
+	ids := make(chan int64, 16)
+	if cbs == nil {
+		cbs = &CallbackHandles{}
+	}
+	connected := cbs.ConnectedCallBackHandle
+	cbs.ConnectedCallBackHandle = func(id int64, req *http.Request) {
+		if connected != nil {
+			connected(id, req)
+		}
+		ids <- id
+	}
+	server.SetCallbacks(cbs)
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		ts.Close()
+		resetTestServer(t, server)
+	})
+	return server, ts, ids
+}
+
+// resetTestServer        断开全局管理器中的所有session,并恢复测试用到的配置
+func resetTestServer(t *testing.T, server ServerHandlerInterface) {
+	for _, sess := range server.GetSessionRange(0, math.MaxUint32) {
+		go sess.DisConnect()
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for server.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("sessions not closed: ", server.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.SetCallbacks(nil)
+	server.SetHandshakeCheckHandle(nil)
+	server.SetHandshakeHandle(nil)
+	server.SetConnProtection(ConnProtection{})
+	server.SetOriginPolicy(nil)
+	server.SetConnectionLimits(ConnectionLimits{})
+	server.SetIPFilter(nil, nil)
+	server.SetHeartbeat(Heartbeat{})
+}
+
+// waitTestId             等待服务端建立的sessionId
+func waitTestId(t *testing.T, ids chan int64) int64 {
+	select {
+	case id := <-ids:
+		return id
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not connected")
+	}
+	return 0
+}
+
+// waitPending            等待 PendingHandshakes 变为n
+func waitPending(t *testing.T, server ServerHandlerInterface, n int64) {
+	deadline := time.Now().Add(2 * time.Second)
+	for server.PendingHandshakes() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("pending: got %d, want %d", server.PendingHandshakes(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_ConnProtectionAcquire(t *testing.T) {
+	c := &connProtection{}
+	c.set(ConnProtection{MaxPendingHandshakes: 1})
+	release, err := c.acquire()
+	if err != nil {
+		t.Fatal("acquireErr: ", err.Error())
+	}
+	_, err = c.acquire()
+	var he *HandshakeError
+	if !errors.As(err, &he) || he.Status != http.StatusServiceUnavailable || he.Reason != HandshakeReasonPending {
+		t.Fatal("expected pending error, got ", err)
+	}
+	// 重复释放只计算一次
+	release()
+	release()
+	if c.getPending() != 0 {
+		t.Fatal("pending: ", c.getPending())
+	}
+	if _, err = c.acquire(); err != nil {
+		t.Fatal("acquireErr: ", err.Error())
+	}
+}
+
+func Test_ConnProtectionPendingRelease(t *testing.T) {
+	server := NewServerHandle()
+	server.SetConnProtection(ConnProtection{MaxPendingHandshakes: 1, FirstFrameTimeout: 300 * time.Millisecond})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// 握手后不发送帧,占用等待中的握手名额
+	if _, err := testDialHandshake(t, ts); err != nil {
+		t.Fatal("handshakeErr: ", err.Error())
+	}
+	waitPending(t, server, 1)
+	if _, err := testDialHandshake(t, ts); err == nil {
+		t.Fatal("handshake over MaxPendingHandshakes should fail")
+	}
+	// 超过 FirstFrameTimeout 后断开,释放名额
+	waitPending(t, server, 0)
+
+	// 读取到第一个完整帧后释放名额
+	sess, err := testDialHandshake(t, ts)
+	if err != nil {
+		t.Fatal("handshakeErr: ", err.Error())
+	}
+	waitPending(t, server, 1)
+	if _, err = sess.Write(1, []byte("hello")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	waitPending(t, server, 0)
+	time.Sleep(400 * time.Millisecond)
+	if server.Len() != 1 {
+		t.Fatal("sessions: ", server.Len())
+	}
+}
@@ -0,0 +1,345 @@
+package websocket_packet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	topicSeparator      = "/" // 主题层级分隔符
+	topicSingleWildcard = "+" // 单层通配符
+	topicMultiWildcard  = "#" // 多层通配符,只能在最后一层
+)
+
+// 内置控制协议的消息类型
+const (
+	PubSubTypeSubscribe   = "subscribe"   // 客户端订阅
+	PubSubTypeUnsubscribe = "unsubscribe" // 客户端取消订阅
+	PubSubTypePublish     = "publish"     // 客户端发布
+	PubSubTypeMessage     = "message"     // 服务端推送给订阅者的消息
+	PubSubTypeAck         = "ack"         // 服务端确认
+	PubSubTypeError       = "error"       // 服务端回复的错误
+)
+
+/*
+PubSubMessage            内置控制协议的消息,以文本帧(json)传输
+  - Type                 消息类型:subscribe,unsubscribe,publish,message,ack,error
+  - Topics               订阅/取消订阅的主题(可以含通配符)列表
+  - Topic                发布或推送的主题
+  - Data                 发布或推送的负载,任意json
+  - Error                错误信息
+*/
+type PubSubMessage struct {
+	Type   string          `json:"type"`
+	Topics []string        `json:"topics,omitempty"`
+	Topic  string          `json:"topic,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+/*
+PubSubInterface              主题的订阅与发布,主题以"/"分层,支持MQTT风格的通配符
+  - "+"                      匹配一层,如: site/+/device
+  - "#"                      匹配零或多层,只能在最后一层,如: site/1/#
+  - 只能订阅在线的session;session断开后,其订阅会自动清除
+  - 自动清除依赖 NewServerHandle 生成的管理器的断开通知,其它实现的 ServerHandlerInterface 需要在断开后调用 UnsubscribeAll
+*/
+type PubSubInterface interface {
+	Subscribe(id int64, patterns ...string) error                           // session订阅主题,session不在线时返回错误
+	Unsubscribe(id int64, patterns ...string)                               // session取消订阅
+	UnsubscribeAll(id int64)                                                // session取消所有订阅
+	Subscriptions(id int64) []string                                        // 返回session的订阅列表
+	Subscribers(topic string) []int64                                       // 返回匹配主题的sessionId列表
+	Publish(topic string, frameType byte, payload []byte) (int, error)      // 发布消息到匹配的session,返回成功发送的session数
+	SetControlProtocol(b bool)                                              // 是否开启内置的json控制协议,默认为false
+	SetPublishCheckHandle(f func(id int64, topic string, data []byte) bool) // 配置客户端通过控制协议发布消息时的校验,返回false则拒绝
+}
+
+// NewPubSub          在 ServerHandlerInterface 之上生成一个 PubSubInterface,server 不是 NewServerHandle 生成的管理器时不会自动清除断开session的订阅
+func NewPubSub(server ServerHandlerInterface) PubSubInterface {
+	ps := &pubSub{
+		server: server,
+		root:   newTopicNode(),
+		subs:   map[int64]map[string]struct{}{},
+	}
+	if m, ok := server.(*sessionManager); ok {
+		m.addHook(ps)
+	}
+	return ps
+}
+
+// topicNode       主题树的节点
+type topicNode struct {
+	children    map[string]*topicNode
+	subscribers map[int64]struct{}
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{
+		children:    map[string]*topicNode{},
+		subscribers: map[int64]struct{}{},
+	}
+}
+
+func (n *topicNode) isEmpty() bool {
+	return len(n.children) == 0 && len(n.subscribers) == 0
+}
+
+// add          添加一个订阅
+func (n *topicNode) add(levels []string, id int64) {
+	node := n
+	for _, level := range levels {
+		child, ok := node.children[level]
+		if !ok {
+			child = newTopicNode()
+			node.children[level] = child
+		}
+		node = child
+	}
+	node.subscribers[id] = struct{}{}
+}
+
+// remove       删除一个订阅,并清理空节点
+func (n *topicNode) remove(levels []string, id int64) {
+	if len(levels) == 0 {
+		delete(n.subscribers, id)
+		return
+	}
+	child, ok := n.children[levels[0]]
+	if !ok {
+		return
+	}
+	child.remove(levels[1:], id)
+	if child.isEmpty() {
+		delete(n.children, levels[0])
+	}
+}
+
+// match        查找匹配主题的订阅者
+func (n *topicNode) match(levels []string, res map[int64]struct{}) {
+	if multi, ok := n.children[topicMultiWildcard]; ok {
+		for id := range multi.subscribers {
+			res[id] = struct{}{}
+		}
+	}
+	if len(levels) == 0 {
+		for id := range n.subscribers {
+			res[id] = struct{}{}
+		}
+		return
+	}
+	if child, ok := n.children[levels[0]]; ok {
+		child.match(levels[1:], res)
+	}
+	if single, ok := n.children[topicSingleWildcard]; ok {
+		single.match(levels[1:], res)
+	}
+}
+
+// splitTopicPattern    校验并拆分订阅的主题
+func splitTopicPattern(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, errors.New("topic pattern is empty")
+	}
+	levels := strings.Split(pattern, topicSeparator)
+	for i, level := range levels {
+		if strings.Contains(level, topicMultiWildcard) {
+			if level != topicMultiWildcard || i != len(levels)-1 {
+				return nil, errors.New(fmt.Sprintf("bad topic pattern(%s): '#' must be the last level", pattern))
+			}
+		}
+		if strings.Contains(level, topicSingleWildcard) && level != topicSingleWildcard {
+			return nil, errors.New(fmt.Sprintf("bad topic pattern(%s): '+' must occupy an entire level", pattern))
+		}
+	}
+	return levels, nil
+}
+
+// splitTopic      校验并拆分发布的主题,发布的主题不能含通配符
+func splitTopic(topic string) ([]string, error) {
+	if topic == "" {
+		return nil, errors.New("topic is empty")
+	}
+	if strings.ContainsAny(topic, topicSingleWildcard+topicMultiWildcard) {
+		return nil, errors.New(fmt.Sprintf("bad topic(%s): wildcards are not allowed", topic))
+	}
+	return strings.Split(topic, topicSeparator), nil
+}
+
+type pubSub struct {
+	mu           sync.RWMutex
+	server       ServerHandlerInterface
+	root         *topicNode
+	subs         map[int64]map[string]struct{}
+	isControl    bool
+	publishCheck func(id int64, topic string, data []byte) bool
+}
+
+func (p *pubSub) Subscribe(id int64, patterns ...string) error {
+	var list [][]string
+	for _, pattern := range patterns {
+		levels, err := splitTopicPattern(pattern)
+		if err != nil {
+			return err
+		}
+		list = append(list, levels)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 在锁内确认session未断开:断开时先从管理器移除,再执行 UnsubscribeAll,UnsubscribeAll 会在这里之后执行
+	if _, err := p.server.GetSessionOnce(id); err != nil {
+		return err
+	}
+	set, ok := p.subs[id]
+	if !ok {
+		set = map[string]struct{}{}
+		p.subs[id] = set
+	}
+	for i, levels := range list {
+		p.root.add(levels, id)
+		set[patterns[i]] = struct{}{}
+	}
+	return nil
+}
+
+func (p *pubSub) Unsubscribe(id int64, patterns ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	set, ok := p.subs[id]
+	if !ok {
+		return
+	}
+	for _, pattern := range patterns {
+		if _, ok := set[pattern]; !ok {
+			continue
+		}
+		delete(set, pattern)
+		p.root.remove(strings.Split(pattern, topicSeparator), id)
+	}
+	if len(set) == 0 {
+		delete(p.subs, id)
+	}
+}
+
+func (p *pubSub) UnsubscribeAll(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for pattern := range p.subs[id] {
+		p.root.remove(strings.Split(pattern, topicSeparator), id)
+	}
+	delete(p.subs, id)
+}
+
+func (p *pubSub) Subscriptions(id int64) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var list []string
+	for pattern := range p.subs[id] {
+		list = append(list, pattern)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (p *pubSub) Subscribers(topic string) []int64 {
+	levels, err := splitTopic(topic)
+	if err != nil {
+		return nil
+	}
+	res := map[int64]struct{}{}
+	p.mu.RLock()
+	p.root.match(levels, res)
+	p.mu.RUnlock()
+	var ids []int64
+	for id := range res {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (p *pubSub) Publish(topic string, frameType byte, payload []byte) (int, error) {
+	if _, err := splitTopic(topic); err != nil {
+		return 0, err
+	}
+	var count int
+	for _, id := range p.Subscribers(topic) {
+		if _, err := p.server.SendMessage(id, frameType, payload); err == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (p *pubSub) SetControlProtocol(b bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.isControl = b
+}
+
+func (p *pubSub) SetPublishCheckHandle(f func(id int64, topic string, data []byte) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.publishCheck = f
+}
+
+func (p *pubSub) onConnected(id int64, req *http.Request) {}
+
+func (p *pubSub) onDisConnected(id int64) {
+	p.UnsubscribeAll(id)
+}
+
+// onMessage      开启控制协议时,处理文本帧中的控制消息
+func (p *pubSub) onMessage(id int64, t byte, payload []byte) bool {
+	p.mu.RLock()
+	isControl, publishCheck := p.isControl, p.publishCheck
+	p.mu.RUnlock()
+	if !isControl || t != 1 {
+		return false
+	}
+	var msg PubSubMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	switch msg.Type {
+	case PubSubTypeSubscribe:
+		if err := p.Subscribe(id, msg.Topics...); err != nil {
+			p.reply(id, PubSubMessage{Type: PubSubTypeError, Topics: msg.Topics, Error: err.Error()})
+		} else {
+			p.reply(id, PubSubMessage{Type: PubSubTypeAck, Topics: msg.Topics})
+		}
+	case PubSubTypeUnsubscribe:
+		p.Unsubscribe(id, msg.Topics...)
+		p.reply(id, PubSubMessage{Type: PubSubTypeAck, Topics: msg.Topics})
+	case PubSubTypePublish:
+		if _, err := splitTopic(msg.Topic); err != nil {
+			p.reply(id, PubSubMessage{Type: PubSubTypeError, Topic: msg.Topic, Error: err.Error()})
+			return true
+		}
+		if publishCheck != nil && !publishCheck(id, msg.Topic, msg.Data) {
+			p.reply(id, PubSubMessage{Type: PubSubTypeError, Topic: msg.Topic, Error: "publish is not allowed"})
+			return true
+		}
+		bs, err := json.Marshal(PubSubMessage{Type: PubSubTypeMessage, Topic: msg.Topic, Data: msg.Data})
+		if err != nil {
+			return true
+		}
+		p.Publish(msg.Topic, 1, bs)
+	default:
+		return false
+	}
+	return true
+}
+
+// reply          回复控制消息
+func (p *pubSub) reply(id int64, msg PubSubMessage) {
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	p.server.SendMessage(id, 1, bs)
+}
@@ -0,0 +1,193 @@
+package websocket_packet
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_TopicMatch(t *testing.T) {
+	live := map[int64]bool{}
+	for id := int64(1); id <= 7; id++ {
+		live[id] = true
+	}
+	ps := NewPubSub(&testPresenceServer{live: live}).(*pubSub)
+	subs := map[int64]string{
+		1: "site/+/device/#",
+		2: "site/1/device/2",
+		3: "site/#",
+		4: "#",
+		5: "site/+",
+		6: "other/+/device",
+	}
+	for id, pattern := range subs {
+		if err := ps.Subscribe(id, pattern); err != nil {
+			t.Fatal("subscribeErr: ", err.Error())
+		}
+	}
+	cases := map[string][]int64{
+		"site/1/device/2": {1, 2, 3, 4},
+		"site/1/device":   {1, 3, 4},
+		"site/1":          {3, 4, 5},
+		"site":            {3, 4},
+		"other/1/device":  {4, 6},
+	}
+	for topic, want := range cases {
+		got := ps.Subscribers(topic)
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if len(got) != len(want) {
+			t.Fatalf("topic(%s): got %v, want %v", topic, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("topic(%s): got %v, want %v", topic, got, want)
+			}
+		}
+	}
+	ps.onDisConnected(1)
+	if len(ps.Subscriptions(1)) != 0 {
+		t.Fatal("subscriptions not cleaned up")
+	}
+	for id := range subs {
+		ps.UnsubscribeAll(id)
+	}
+	if !ps.root.isEmpty() {
+		t.Fatal("topic tree is not empty")
+	}
+	for _, bad := range []string{"", "a/#/b", "a/b+", "a#"} {
+		if err := ps.Subscribe(7, bad); err == nil {
+			t.Fatalf("pattern(%s) should be rejected", bad)
+		}
+	}
+}
+
+func Test_PubSubSubscribeClosed(t *testing.T) {
+	server := &testPresenceServer{live: map[int64]bool{1: true}}
+	ps := NewPubSub(server).(*pubSub)
+	if err := ps.Subscribe(2, "a/b"); err == nil {
+		t.Fatal("subscribe unknown session should fail")
+	}
+	// 控制消息在 onDisConnected 之后才被处理:先从管理器移除,再执行 onDisConnected
+	server.mu.Lock()
+	delete(server.live, 1)
+	server.mu.Unlock()
+	ps.onDisConnected(1)
+	if err := ps.Subscribe(1, "a/b"); err == nil {
+		t.Fatal("subscribe closed session should fail")
+	}
+	if len(ps.Subscriptions(1)) != 0 || !ps.root.isEmpty() {
+		t.Fatal("closed session subscribed")
+	}
+}
+
+// sendPubSub             以文本帧发送控制消息
+func sendPubSub(t *testing.T, sess Session, msg PubSubMessage) {
+	bs, _ := json.Marshal(msg)
+	if _, err := sess.Write(1, bs); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+}
+
+// readPubSub             读取一个控制消息
+func readPubSub(t *testing.T, msgs chan []byte) PubSubMessage {
+	var msg PubSubMessage
+	select {
+	case bs := <-msgs:
+		if err := json.Unmarshal(bs, &msg); err != nil {
+			t.Fatal("unmarshalErr: ", err.Error())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pubsub message timeout")
+	}
+	return msg
+}
+
+// expectNoPubSub         d内没有收到消息
+func expectNoPubSub(t *testing.T, msgs chan []byte, d time.Duration) {
+	select {
+	case bs := <-msgs:
+		t.Fatal("unexpected message: ", string(bs))
+	case <-time.After(d):
+	}
+}
+
+func Test_PubSubControlProtocol(t *testing.T) {
+	frames := make(chan string, 1)
+	server, ts, ids := newTestServer(t, &CallbackHandles{
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) { frames <- string(payload) },
+	})
+	ps := NewPubSub(server)
+	ps.SetControlProtocol(true)
+	t.Cleanup(func() { ps.SetControlProtocol(false) })
+	ps.SetPublishCheckHandle(func(id int64, topic string, data []byte) bool {
+		return topic != "chat/secret"
+	})
+	sub, subMsgs := testDialSession(t, ts, nil)
+	subId := waitTestId(t, ids)
+	pub, pubMsgs := testDialSession(t, ts, nil)
+	waitTestId(t, ids)
+
+	sendPubSub(t, sub, PubSubMessage{Type: PubSubTypeSubscribe, Topics: []string{"chat/+"}})
+	if msg := readPubSub(t, subMsgs); msg.Type != PubSubTypeAck || len(msg.Topics) != 1 || msg.Topics[0] != "chat/+" {
+		t.Fatalf("subscribe reply: %+v", msg)
+	}
+	sendPubSub(t, sub, PubSubMessage{Type: PubSubTypeSubscribe, Topics: []string{"a/#/b"}})
+	if msg := readPubSub(t, subMsgs); msg.Type != PubSubTypeError || msg.Error == "" {
+		t.Fatalf("bad pattern reply: %+v", msg)
+	}
+
+	sendPubSub(t, pub, PubSubMessage{Type: PubSubTypePublish, Topic: "chat/1", Data: json.RawMessage(`{"x":1}`)})
+	if msg := readPubSub(t, subMsgs); msg.Type != PubSubTypeMessage || msg.Topic != "chat/1" || string(msg.Data) != `{"x":1}` {
+		t.Fatalf("message: %+v", msg)
+	}
+	// 发布时校验失败,或主题含通配符时回复错误
+	sendPubSub(t, pub, PubSubMessage{Type: PubSubTypePublish, Topic: "chat/secret", Data: json.RawMessage(`1`)})
+	if msg := readPubSub(t, pubMsgs); msg.Type != PubSubTypeError || msg.Topic != "chat/secret" {
+		t.Fatalf("publish check reply: %+v", msg)
+	}
+	sendPubSub(t, pub, PubSubMessage{Type: PubSubTypePublish, Topic: "chat/+", Data: json.RawMessage(`1`)})
+	if msg := readPubSub(t, pubMsgs); msg.Type != PubSubTypeError {
+		t.Fatalf("wildcard publish reply: %+v", msg)
+	}
+	expectNoPubSub(t, subMsgs, 100*time.Millisecond)
+
+	// 不是控制消息时传递给 FrameCallBackHandle
+	if _, err := pub.Write(1, []byte("hello")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	select {
+	case msg := <-frames:
+		if msg != "hello" {
+			t.Fatal("frame: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame callback timeout")
+	}
+
+	sendPubSub(t, sub, PubSubMessage{Type: PubSubTypeUnsubscribe, Topics: []string{"chat/+"}})
+	if msg := readPubSub(t, subMsgs); msg.Type != PubSubTypeAck {
+		t.Fatalf("unsubscribe reply: %+v", msg)
+	}
+	sendPubSub(t, pub, PubSubMessage{Type: PubSubTypePublish, Topic: "chat/1", Data: json.RawMessage(`2`)})
+	expectNoPubSub(t, subMsgs, 100*time.Millisecond)
+
+	// 断开后通过管理器的钩子清除订阅,之后的订阅被拒绝
+	if err := ps.Subscribe(subId, "chat/#"); err != nil {
+		t.Fatal("subscribeErr: ", err.Error())
+	}
+	sub.DisConnect()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(ps.Subscriptions(subId)) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscriptions not cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := ps.Subscribe(subId, "chat/#"); err == nil {
+		t.Fatal("subscribe closed session should fail")
+	}
+	if ids := ps.Subscribers("chat/1"); len(ids) != 0 {
+		t.Fatal("subscribers: ", ids)
+	}
+}
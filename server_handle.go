@@ -14,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,6 +26,10 @@ type CallbackHandles struct {
 	session.ConnectedCallBackHandle  // 建立链接后的回调
 	session.DisConnectCallBackHandle // 断开链接后的回调
 	session.FrameCallBackHandle      // 帧读取后的回调
+	session.PingCallBackHandle       // 收到ping帧后的回调,为空时以相同的负载回复pong帧
+	session.PongCallBackHandle       // 收到pong帧后的回调
+	session.PingPayloadHandle        // 心跳ping帧的负载,为空时使用默认负载;单个 Session 可以用 Session.SetPingPayloadHandle 修改
+	session.StreamCallBackHandle     // 以流的方式接收消息的回调,配置后不再执行 FrameCallBackHandle 及内置的消息处理(如 PubSub 的控制协议)
 }
 
 /*
@@ -42,11 +47,31 @@ type ServerHandlerInterface interface {
 	GetSessionWithIds(ids ...int64) map[int64]Session                                  // 获取获取 Session 列表
 	DisConnect(id int64) error                                                         // 断开一个 Session
 	ServeHTTP(w http.ResponseWriter, req *http.Request)                                // 实现net.http.Handler
-	SetHandshakeCheckHandle(f func(req *http.Request) error)                           // 配置一个校验的握手的handle
+	SetHandshakeCheckHandle(f func(req *http.Request) error)                           // 配置一个校验的握手的handle,返回错误时回复404;返回 *HandshakeError 时按其状态码回复
+	SetHandshakeHandle(f HandshakeHandle)                                              // 配置一个校验的握手的handle,可以配置回复的响应头与拒绝的状态码,在 SetHandshakeCheckHandle 之后执行
 	SendMessage(id int64, frameType byte, payload []byte, keys ...uint32) (int, error) // 发送消息到客户端
 	SetStatistics(b bool)                                                              // 是否开启流量统计,在执行ServeHTTP之前有效,默认为false
 	SetPingTime(t int64)                                                               // 配置自动发送pingFrame的时间(秒),在执行ServeHTTP之前有效,<1:关闭(默认值); 1~~25:都会配置为25秒; >120:都会配置为120秒
-	SetTimeOut(i int64)                                                                // 配置 Session 超时,在执行ServeHTTP之前有效
+	SetTimeOut(i int64)                                                                // 配置 Session 空闲超时(秒),在执行ServeHTTP之前有效,等同于 SetIdlePolicy(IdlePolicy{Timeout: i秒})
+	Presence() PresenceInterface                                                       // 返回在线状态管理
+	FindByTag(key, value string) []Session                                             // 按标签查找 Session 列表
+	FindIdsByTag(key, value string) []int64                                            // 按标签查找 sessionId 列表
+	TagValues(key string) []string                                                     // 返回某个标签在所有 Session 中的值
+	SetSubprotocols(protocols ...string)                                               // 配置服务端支持的子协议(按优先级),在执行ServeHTTP之前有效
+	SetOriginPolicy(p *OriginPolicy)                                                   // 配置 Origin 校验策略,为空时使用默认的同源策略
+	SetHandshakeAuditHandle(f func(a HandshakeAudit))                                  // 配置握手审计的回调
+	GetHandshakeMetrics() HandshakeMetrics                                             // 返回握手统计
+	SetConnectionLimits(l ConnectionLimits)                                            // 配置链接数限制
+	SetTrustedProxies(cidrs ...string) error                                           // 配置受信任的代理(CIDR),来自受信任代理的请求使用 X-Forwarded-For 或 X-Real-IP 作为客户端ip
+	SetIPFilter(allow, deny []string) error                                            // 配置ip(CIDR)的白名单与黑名单,可以在运行时重新加载;白名单为空时不限制
+	SetRateLimit(l *RateLimit)                                                         // 配置每个 Session 接收消息的速率限制,为空时不限制,对之后建立的 Session 有效
+	SetMessageLimits(l MessageLimits)                                                  // 配置 Session 接收消息的大小限制,对之后建立的 Session 有效;单个 Session 可以用 Session.SetMessageLimits 修改
+	SetConnProtection(p ConnProtection)                                                // 配置链接保护(防止慢速攻击),对之后的握手有效
+	PendingHandshakes() int64                                                          // 返回等待中的握手(开始握手,到读取到第一个完整帧)数
+	SetIdlePolicy(p IdlePolicy)                                                        // 配置 Session 空闲超时策略,对之后建立的 Session 有效;单个 Session 可以在握手时用 SetHandshakeIdlePolicy 或之后用 Session.SetIdlePolicy 修改
+	SetHeartbeat(h Heartbeat)                                                          // 配置心跳(可以小于一秒,不受 SetPingTime 的限制),对之后建立的 Session 有效;配置后 SetPingTime 无效
+	SetCodecOptions(o CodecOptions)                                                    // 配置 Session 的编解码器(帧与消息的大小限制,分包大小,严格校验),对之后建立的 Session 有效;Role 固定为 frame.RoleServer
+	SetWriteCoalescing(c WriteCoalescing)                                              // 配置 Session 的写入合并,对之后建立的 Session 有效;单个 Session 可以用 Session.SetWriteCoalescing 修改(如对延迟敏感的 Session 关闭合并)
 }
 
 // NewServerHandle      生成一个全局唯一的 ServerHandlerInterface
@@ -70,36 +95,194 @@ func (ks itemKeys) Swap(i, j int) {
 
 type sessionItem struct {
 	Session
-	t *time.Timer
-}
-
-func (i sessionItem) timerReset(d time.Duration) {
-	if i.t != nil {
-		i.t.Reset(d)
-	}
 }
 
 func newManager() *sessionManager {
 	managerOnce.Do(func() {
 		manager = &sessionManager{
 			mu:                   sync.RWMutex{},
-			cb:                   nil,
 			m:                    map[int64]sessionItem{},
 			handshakeCheckHandle: nil,
+			tags:                 newTagIndex(),
+			audit:                newHandshakeAudit(),
+			proxies:              &trustedProxies{},
+			ipFilter:             &ipFilter{},
+			protection:           &connProtection{},
 		}
+		manager.limiter = newConnLimiter(manager.tags)
 	})
 	return manager
 }
 
 type sessionManager struct {
 	mu                   sync.RWMutex
-	cb                   *CallbackHandles
+	cb                   atomic.Value // *CallbackHandles,可以在运行时替换
 	m                    map[int64]sessionItem
 	handshakeCheckHandle func(req *http.Request) error
-	timeOutSecond        int64
+	handshakeHandle      HandshakeHandle
+	idlePolicy           session.IdlePolicy
 	pingTime             int64
+	heartbeat            *session.Heartbeat
+	writeCoalescing      *session.WriteCoalescing
+	codecOptions         *frame.CodecOptions
 	isServerHttp         bool
 	isStatistics         bool
+	hooks                []sessionHook
+	presence             *presence
+	tags                 *tagIndex
+	subprotocols         []string
+	originPolicy         *OriginPolicy
+	audit                *handshakeAudit
+	proxies              *trustedProxies
+	limiter              *connLimiter
+	ipFilter             *ipFilter
+	rateLimit            *session.RateLimit
+	messageLimits        *session.MessageLimits
+	protection           *connProtection
+}
+
+/*
+sessionHook            服务端内部的session事件钩子,供pubsub等子模块使用
+  - onConnected        session加入管理器后执行
+  - onDisConnected     session从管理器移除后执行
+  - onMessage          收到数据帧时执行,返回true表示该消息已被处理,不再传递给 FrameCallBackHandle
+*/
+type sessionHook interface {
+	onConnected(id int64, req *http.Request)
+	onDisConnected(id int64)
+	onMessage(id int64, t byte, payload []byte) bool
+}
+
+// addHook       添加一个session事件钩子
+func (s *sessionManager) addHook(h sessionHook) {
+	if h == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, h)
+}
+
+// getHooks      返回钩子列表的拷贝
+func (s *sessionManager) getHooks() []sessionHook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.hooks) == 0 {
+		return nil
+	}
+	hooks := make([]sessionHook, len(s.hooks))
+	copy(hooks, s.hooks)
+	return hooks
+}
+
+func (s *sessionManager) Presence() PresenceInterface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.presence == nil {
+		s.presence = newPresence(s)
+		s.hooks = append(s.hooks, s.presence)
+	}
+	return s.presence
+}
+
+func (s *sessionManager) FindByTag(key, value string) []Session {
+	ids := s.tags.find(key, value)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Session
+	for _, id := range ids {
+		if item, ok := s.m[id]; ok {
+			list = append(list, item.Session)
+		}
+	}
+	return list
+}
+
+func (s *sessionManager) FindIdsByTag(key, value string) []int64 {
+	return s.tags.find(key, value)
+}
+
+func (s *sessionManager) TagValues(key string) []string {
+	return s.tags.values(key)
+}
+
+func (s *sessionManager) SetSubprotocols(protocols ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isServerHttp {
+		s.subprotocols = protocols
+	}
+}
+
+func (s *sessionManager) SetOriginPolicy(p *OriginPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.originPolicy = p
+}
+
+func (s *sessionManager) SetHandshakeAuditHandle(f func(a HandshakeAudit)) {
+	s.audit.setCallBack(f)
+}
+
+func (s *sessionManager) GetHandshakeMetrics() HandshakeMetrics {
+	return s.audit.getMetrics()
+}
+
+func (s *sessionManager) SetConnectionLimits(l ConnectionLimits) {
+	s.limiter.setLimits(l)
+}
+
+func (s *sessionManager) SetTrustedProxies(cidrs ...string) error {
+	return s.proxies.set(cidrs...)
+}
+
+func (s *sessionManager) SetIPFilter(allow, deny []string) error {
+	return s.ipFilter.set(allow, deny)
+}
+
+func (s *sessionManager) SetRateLimit(l *RateLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = l
+}
+
+func (s *sessionManager) SetMessageLimits(l MessageLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messageLimits = &l
+}
+
+func (s *sessionManager) SetConnProtection(p ConnProtection) {
+	s.protection.set(p)
+}
+
+func (s *sessionManager) PendingHandshakes() int64 {
+	return s.protection.getPending()
+}
+
+func (s *sessionManager) SetIdlePolicy(p IdlePolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idlePolicy = p
+}
+
+func (s *sessionManager) SetHeartbeat(h Heartbeat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeat = &h
+}
+
+func (s *sessionManager) SetWriteCoalescing(c WriteCoalescing) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeCoalescing = &c
+}
+
+func (s *sessionManager) SetCodecOptions(o CodecOptions) {
+	o.Role = frame.RoleServer
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codecOptions = &o
 }
 
 func (s *sessionManager) SetStatistics(b bool) {
@@ -131,8 +314,21 @@ func (s *sessionManager) SetHandshakeCheckHandle(f func(req *http.Request) error
 		s.handshakeCheckHandle = f
 	}
 }
+func (s *sessionManager) SetHandshakeHandle(f HandshakeHandle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.m) == 0 {
+		s.handshakeHandle = f
+	}
+}
 func (s *sessionManager) SetCallbacks(callbacks *CallbackHandles) {
-	s.cb = callbacks
+	s.cb.Store(callbacks)
+}
+
+// getCallbacks     返回回调组,未配置时返回nil
+func (s *sessionManager) getCallbacks() *CallbackHandles {
+	cb, _ := s.cb.Load().(*CallbackHandles)
+	return cb
 }
 
 func (s *sessionManager) Len() int {
@@ -207,7 +403,7 @@ func (s *sessionManager) SetTimeOut(i int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if !s.isServerHttp {
-		s.timeOutSecond = i
+		s.idlePolicy.Timeout = time.Duration(i) * time.Second
 	}
 }
 
@@ -216,70 +412,118 @@ func (s *sessionManager) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	s.isServerHttp = true
 	var conn net.Conn
 	var err error
-	conn, err = serverUpgradeHandler(req, w, s.handshakeCheckHandle)
-	if err != nil {
-		httpResponseError(w, 404, err)
-		return
-	}
-	err = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	if err != nil {
-		return
-	}
-	_, err = conn.Write(makeServerHandshakeBytes(req))
-	if err != nil {
-		return
+	var hv *handshakeValues
+	var ticket *limitTicket
+	req, hv = withHandshakeValues(req)
+	clientIP := s.proxies.clientIP(req)
+	resp := newHandshakeResponse()
+	// ip校验在所有校验与回调之前
+	err = s.ipFilter.check(remoteIP(req), clientIP)
+	release := func() {}
+	if err == nil {
+		release, err = s.protection.acquire()
+	}
+	if err == nil {
+		conn, err = serverUpgradeHandler(req, w, func(r *http.Request) error {
+			if err := s.checkHandshake(r, resp); err != nil {
+				return err
+			}
+			var limitErr error
+			ticket, limitErr = s.limiter.reserve(clientIP.String(), hv.getTags())
+			return limitErr
+		})
 	}
-	err = conn.SetWriteDeadline(time.Time{})
+	s.audit.record(req, err)
 	if err != nil {
+		release()
+		ticket.release()
+		writeHandshakeError(w, err)
 		return
 	}
-	err = conn.SetDeadline(time.Time{})
+	defer func() {
+		if err != nil {
+			release()
+			ticket.release()
+			conn.Close()
+		}
+	}()
+	subprotocol := negotiateSubprotocol(req, s.subprotocols, resp)
+	err = writeUpgradeResponse(conn, makeServerHandshakeBytes(req, subprotocol, resp.header))
 	if err != nil {
 		return
 	}
-	go s.addSession(conn, req)
+	info := session.NewHandshakeInfo(req, subprotocol)
+	info.ClientIP = clientIP.String()
+	go s.addSession(conn, req, hv, info, ticket, s.protection.readProtection(req, release))
 }
-func (s *sessionManager) doTimeOut(id int64) {
-	item := s.delSession(id)
-	if item != nil {
-		if item.t != nil {
-			item.t.Stop()
+
+// checkHandshake      执行 Origin 校验及配置的握手校验
+func (s *sessionManager) checkHandshake(req *http.Request, resp *HandshakeResponse) error {
+	s.mu.RLock()
+	originPolicy, checkHandle, handshake := s.originPolicy, s.handshakeCheckHandle, s.handshakeHandle
+	s.mu.RUnlock()
+	if !originPolicy.Check(req) {
+		return &HandshakeError{Status: http.StatusForbidden, Body: "origin not allowed", Reason: HandshakeReasonOrigin}
+	}
+	if checkHandle != nil {
+		if err := checkHandle(req); err != nil {
+			return toHandshakeError(err, HandshakeReasonCheck)
 		}
-		// 如果是超时,给出 1008 状态码,(1008): 协议违规，表示违反了协议的约束或策略
-		item.Session.DisConnect(frame.ClosePolicyViolation)
 	}
+	if handshake != nil {
+		return decisionToError(handshake(req, resp), resp)
+	}
+	return nil
 }
+
 func (s *sessionManager) delSession(id int64) *sessionItem {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if item, ok := s.m[id]; ok {
 		delete(s.m, id)
-		if item.t != nil {
-			item.t.Stop()
-		}
+		s.tags.unregister(id)
+		s.limiter.unregister(id)
 		return &item
 	}
 	return nil
 }
-func (s *sessionManager) addSession(conn net.Conn, req *http.Request) {
+func (s *sessionManager) addSession(conn net.Conn, req *http.Request, hv *handshakeValues, info *session.HandshakeInfo, ticket *limitTicket, rp *session.ReadProtection) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	sess := session.NewSession(conn, true, &session.ConfigureSession{
 		ConnectedCallBackHandle: nil,
 		DisConnectCallBack:      s.doDisConnCb,
 		FrameCallBackHandle:     s.doMsgCb,
+		PingCallBackHandle:      s.doPingCb,
+		PongCallBackHandle:      s.doPongCb,
+		PingPayloadHandle:       s.doPingPayload,
 		IsStatistics:            s.isStatistics,
 		AutoPingTicker:          s.pingTime,
+		Heartbeat:               s.heartbeat,
+		Codec:                   s.codecOptions,
+		WriteCoalescing:         s.writeCoalescing,
+		StreamCallBackHandle:    s.getStreamCb(),
+		Tags:                    hv.getTags(),
+		TagCallBackHandle:       s.tags.onTagChange,
+		Handshake:               info,
+		Values:                  hv.getValues(),
+		RateLimit:               s.rateLimit,
+		MessageLimits:           s.messageLimits,
+		ReadProtection:          rp,
+		IdlePolicy:              hv.getIdlePolicy(s.idlePolicy),
 	})
 	sessionId := sess.GetId()
+	s.tags.register(sessionId, sess.GetTags())
+	ticket.commit(sessionId)
+	if ticket != nil {
+		for _, id := range ticket.evict {
+			if item, ok := s.m[id]; ok {
+				go item.DisConnect(frame.ClosePolicyViolation)
+			}
+		}
+	}
 	item := sessionItem{
 		Session: sess,
-		t:       nil,
-	}
-	if s.timeOutSecond >= 1 {
-		item.t = time.AfterFunc(time.Duration(s.timeOutSecond)*time.Second, func() {
-			newManager().doTimeOut(item.GetId())
-		})
 	}
 	s.m[sessionId] = item
 	go s.doConnCb(sessionId, req)
@@ -287,26 +531,75 @@ func (s *sessionManager) addSession(conn net.Conn, req *http.Request) {
 }
 
 func (s *sessionManager) doConnCb(id int64, req *http.Request) {
-	if s.cb != nil && s.cb.ConnectedCallBackHandle != nil {
-		go s.cb.ConnectedCallBackHandle(id, req)
+	for _, h := range s.getHooks() {
+		h.onConnected(id, req)
+	}
+	cb := s.getCallbacks()
+	if cb != nil && cb.ConnectedCallBackHandle != nil {
+		go cb.ConnectedCallBackHandle(id, req)
 	}
 }
 func (s *sessionManager) doDisConnCb(id int64, status ClientStatus, db *session.ConnectionDatabase) {
 	item := s.delSession(id)
-	if item != nil && s.cb != nil && s.cb.DisConnectCallBackHandle != nil {
-		go s.cb.DisConnectCallBackHandle(id, status, db)
+	if item == nil {
+		return
+	}
+	s.doDisConnHooks(id)
+	cb := s.getCallbacks()
+	if cb != nil && cb.DisConnectCallBackHandle != nil {
+		go cb.DisConnectCallBackHandle(id, status, db)
 	}
 }
 
+// doDisConnHooks     session移除后通知钩子
+func (s *sessionManager) doDisConnHooks(id int64) {
+	for _, h := range s.getHooks() {
+		h.onDisConnected(id)
+	}
+}
+
+// getStreamCb    返回流式消息的回调,建立 Session 时确定接收消息的方式
+func (s *sessionManager) getStreamCb() session.StreamCallBackHandle {
+	cb := s.getCallbacks()
+	if cb == nil {
+		return nil
+	}
+	return cb.StreamCallBackHandle
+}
+
+func (s *sessionManager) doPingCb(id int64, payload []byte) ([]byte, bool) {
+	cb := s.getCallbacks()
+	if cb != nil && cb.PingCallBackHandle != nil {
+		return cb.PingCallBackHandle(id, payload)
+	}
+	return payload, true
+}
+
+func (s *sessionManager) doPongCb(id int64, payload []byte) {
+	cb := s.getCallbacks()
+	if cb != nil && cb.PongCallBackHandle != nil {
+		cb.PongCallBackHandle(id, payload)
+	}
+}
+
+func (s *sessionManager) doPingPayload(id int64) []byte {
+	cb := s.getCallbacks()
+	if cb != nil && cb.PingPayloadHandle != nil {
+		return cb.PingPayloadHandle(id)
+	}
+	return nil
+}
+
 func (s *sessionManager) doMsgCb(id int64, t byte, payload []byte) {
 	//println("---- server_handle.doMsgCb ----  type: ", t)
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	if item, ok := s.m[id]; ok && item.t != nil && s.timeOutSecond >= 1 {
-		item.t.Reset(time.Duration(s.timeOutSecond) * time.Second)
+	for _, h := range s.getHooks() {
+		if h.onMessage(id, t, payload) {
+			return
+		}
 	}
-	if s.cb != nil && s.cb.FrameCallBackHandle != nil {
-		go s.cb.FrameCallBackHandle(id, t, payload)
+	cb := s.getCallbacks()
+	if cb != nil && cb.FrameCallBackHandle != nil {
+		go cb.FrameCallBackHandle(id, t, payload)
 	}
 }
 
@@ -314,23 +607,23 @@ func (s *sessionManager) doMsgCb(id int64, t byte, payload []byte) {
 func serverUpgradeHandler(req *http.Request, w http.ResponseWriter, otherHandle func(req *http.Request) error) (conn net.Conn, err error) {
 	err = defaultUpgradeCheck(req)
 	if err != nil {
-		return
+		return nil, toHandshakeError(err, HandshakeReasonProtocol)
 	}
 	if otherHandle != nil {
 		err = otherHandle(req)
 		if err != nil {
-			return
+			return nil, toHandshakeError(err, HandshakeReasonCheck)
 		}
 	}
 	hj, ok := w.(http.Hijacker)
 	if !ok {
-		return nil, errors.New("this ResponseWriter is not Hijacker")
+		return nil, toHandshakeError(errors.New("this ResponseWriter is not Hijacker"), HandshakeReasonProtocol)
 	}
-	conn, _, err = hj.Hijack()
+	conn, brw, err := hj.Hijack()
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("HijackErr: %s", err.Error()))
+		return nil, &HandshakeError{Status: http.StatusInternalServerError, Body: fmt.Sprintf("HijackErr: %s", err.Error()), Reason: HandshakeReasonHijack}
 	}
-	return conn, nil
+	return withBuffered(conn, brw.Reader), nil
 }
 
 func defaultUpgradeCheck(r *http.Request) error {
@@ -387,13 +680,64 @@ func checkSecWebsocketKey(h http.Header) bool {
 	return err == nil && len(decoded) == 16
 }
 
+// headerValueReplacer   防止响应头的值中出现换行
+var headerValueReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// selectSubprotocol    按服务端的优先级选择客户端请求的子协议,没有匹配时返回空字符串
+func selectSubprotocol(req *http.Request, protocols []string) string {
+	if len(protocols) == 0 {
+		return ""
+	}
+	var offered []string
+	for _, val := range req.Header.Values("Sec-Websocket-Protocol") {
+		for _, p := range strings.Split(val, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				offered = append(offered, p)
+			}
+		}
+	}
+	for _, p := range protocols {
+		for _, o := range offered {
+			if p == o {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// negotiateSubprotocol        协商子协议,握手钩子设置的 Sec-WebSocket-Protocol 只有在客户端提供了该子协议时才覆盖协商的结果
+func negotiateSubprotocol(req *http.Request, protocols []string, resp *HandshakeResponse) string {
+	if p := resp.header.Get("Sec-Websocket-Protocol"); p != "" && selectSubprotocol(req, []string{p}) == p {
+		return p
+	}
+	return selectSubprotocol(req, protocols)
+}
+
 // makeServerHandshakeBytes    生成服务端回复的报文
-func makeServerHandshakeBytes(req *http.Request) []byte {
+func makeServerHandshakeBytes(req *http.Request, subprotocol string, header http.Header) []byte {
 	key := req.Header.Get("Sec-Websocket-Key")
 	var p []byte
 	p = append(p, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: "...)
 	p = append(p, computeAcceptKey(key)...)
 	p = append(p, "\r\n"...)
+	if subprotocol != "" {
+		p = append(p, "Sec-WebSocket-Protocol: "...)
+		p = append(p, subprotocol...)
+		p = append(p, "\r\n"...)
+	}
+	for key, values := range header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Upgrade", "Connection", "Sec-Websocket-Accept", "Sec-Websocket-Protocol":
+			continue
+		}
+		for _, value := range values {
+			p = append(p, key...)
+			p = append(p, ": "...)
+			p = append(p, headerValueReplacer.Replace(value)...)
+			p = append(p, "\r\n"...)
+		}
+	}
 	p = append(p, "\r\n"...)
 	return p
 }
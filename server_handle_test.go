@@ -0,0 +1,73 @@
+package websocket_packet
+
+import (
+	"bytes"
+	"github.com/qdmc/websocket_packet/session"
+	"testing"
+	"time"
+)
+
+// waitBytes          等待通道中的负载
+func waitBytes(t *testing.T, ch chan []byte, name string) []byte {
+	select {
+	case bs := <-ch:
+		return bs
+	case <-time.After(2 * time.Second):
+		t.Fatal(name, " timeout")
+	}
+	return nil
+}
+
+func Test_ServerControlCallbacks(t *testing.T) {
+	pongs := make(chan []byte, 16)
+	server, ts, ids := newTestServer(t, &CallbackHandles{
+		PingCallBackHandle: func(id int64, payload []byte) ([]byte, bool) {
+			if string(payload) == "quiet" {
+				return nil, false
+			}
+			return append([]byte("server:"), payload...), true
+		},
+		PongCallBackHandle: func(id int64, payload []byte) {
+			pongs <- append([]byte(nil), payload...)
+		},
+		PingPayloadHandle: func(id int64) []byte {
+			return bytes.Repeat([]byte("s"), 200)
+		},
+	})
+	server.SetHeartbeat(Heartbeat{Interval: 50 * time.Millisecond})
+	clientPongs := make(chan []byte, 16)
+	serverPings := make(chan []byte, 16)
+	sess := testDialConfig(t, ts, nil, &session.ConfigureSession{
+		PingCallBackHandle: func(id int64, payload []byte) ([]byte, bool) {
+			serverPings <- append([]byte(nil), payload...)
+			return []byte("client-pong"), true
+		},
+		PongCallBackHandle: func(id int64, payload []byte) {
+			clientPongs <- append([]byte(nil), payload...)
+		},
+	})
+	waitTestId(t, ids)
+	// 服务端心跳使用 PingPayloadHandle 的负载,截断为125字节
+	if p := waitBytes(t, serverPings, "server ping"); !bytes.Equal(p, bytes.Repeat([]byte("s"), 125)) {
+		t.Fatal("server ping: ", len(p))
+	}
+	// 客户端的回复交给 PongCallBackHandle
+	if p := waitBytes(t, pongs, "server pong callback"); string(p) != "client-pong" {
+		t.Fatal("server pong: ", string(p))
+	}
+	// 服务端以 PingCallBackHandle 的结果回复
+	if _, err := sess.Write(9, []byte("hi")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	if p := waitBytes(t, clientPongs, "client pong"); string(p) != "server:hi" {
+		t.Fatal("client pong: ", string(p))
+	}
+	if _, err := sess.Write(9, []byte("quiet")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	select {
+	case p := <-clientPongs:
+		t.Fatal("suppressed pong received: ", string(p))
+	case <-time.After(150 * time.Millisecond):
+	}
+}
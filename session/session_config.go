@@ -1,9 +1,27 @@
 package session
 
+import "github.com/qdmc/websocket_packet/frame"
+
 type ConfigureSession struct {
 	ConnectedCallBackHandle ConnectedCallBackHandle  // 建立链接后的回调
 	DisConnectCallBack      DisConnectCallBackHandle // 断开链接后的回调
 	FrameCallBackHandle     FrameCallBackHandle      // 帧读取后的回调
 	IsStatistics            bool                     // 是否开启流量统计,默认为false
 	AutoPingTicker          int64                    // 自动发送pingFrame的时间(秒)配置, <1:关闭(默认值); 1~~25:都会配置为25秒; >120:都会配置为120秒
+	Tags                    map[string]string        // 初始标签
+	TagCallBackHandle       TagCallBackHandle        // 标签变更后的回调,同步执行
+	Handshake               *HandshakeInfo           // 握手快照,为空时只记录链接的地址
+	Values                  map[string]interface{}   // 初始属性,如握手校验时附加的认证信息
+	RateLimit               *RateLimit               // 接收消息的速率限制,为空时不限制
+	MessageLimits           *MessageLimits           // 接收消息的大小限制,为空时使用 Codec 的限制
+	ReadProtection          *ReadProtection          // 读取保护,为空时不限制
+	IdlePolicy              *IdlePolicy              // 空闲超时策略,为空时不限制
+	Heartbeat               *Heartbeat               // 心跳配置,不为空时忽略 AutoPingTicker
+	PingCallBackHandle      PingCallBackHandle       // 收到ping帧后的回调,为空时以相同的负载回复pong帧
+	PongCallBackHandle      PongCallBackHandle       // 收到pong帧后的回调
+	PingPayloadHandle       PingPayloadHandle        // 心跳ping帧的负载,为空时使用默认负载
+	Codec                   *frame.CodecOptions      // 编解码器配置(帧与消息的大小限制,分包大小,严格校验);Role未指定时按 isServer 确定
+	StreamCallBackHandle    StreamCallBackHandle     // 以流的方式接收消息的回调,不为空时不再执行 FrameCallBackHandle
+	PullMode                bool                     // 是否以 NextReader 拉取消息,为true时不再执行 FrameCallBackHandle;未拉取的消息会阻塞读取(包括控制帧)
+	WriteCoalescing         *WriteCoalescing         // 写入合并,为空时不合并
 }
@@ -0,0 +1,75 @@
+package session
+
+// PingCallBackHandle     收到ping帧后的回调,payload只在回调中有效;ok为true时以reply回复pong帧,为false时不回复(可以之后调用 Write 自行回复)
+type PingCallBackHandle func(id int64, payload []byte) (reply []byte, ok bool)
+
+// PongCallBackHandle     收到pong帧后的回调,payload只在回调中有效
+type PongCallBackHandle func(id int64, payload []byte)
+
+// PingPayloadHandle      生成心跳ping帧的负载,返回nil时使用默认负载(序号+发送时间);超过125字节时截断
+type PingPayloadHandle func(id int64) []byte
+
+// controlHandles         控制帧的回调
+type controlHandles struct {
+	onPing      PingCallBackHandle
+	onPong      PongCallBackHandle
+	pingPayload PingPayloadHandle
+}
+
+func (s *websocketSession) SetPingCallBack(back PingCallBackHandle) {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+	s.control.onPing = back
+}
+
+func (s *websocketSession) SetPongCallBack(back PongCallBackHandle) {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+	s.control.onPong = back
+}
+
+func (s *websocketSession) SetPingPayloadHandle(f PingPayloadHandle) {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+	s.control.pingPayload = f
+}
+
+func (s *websocketSession) getControlHandles() controlHandles {
+	s.controlMu.RLock()
+	defer s.controlMu.RUnlock()
+	return s.control
+}
+
+// doPing          处理ping帧,默认以相同的负载回复pong帧
+func (s *websocketSession) doPing(payload []byte) {
+	reply, ok := payload, true
+	if f := s.getControlHandles().onPing; f != nil {
+		reply, ok = f(s.GetId(), payload)
+	}
+	if ok {
+		s.Write(10, reply)
+	}
+}
+
+// doPong          处理pong帧,先匹配心跳,再执行回调
+func (s *websocketSession) doPong(payload []byte) {
+	if s.heartbeat != nil {
+		s.heartbeat.onPong(payload)
+	}
+	if f := s.getControlHandles().onPong; f != nil {
+		f(s.GetId(), payload)
+	}
+}
+
+// pingPayload     返回心跳ping帧的自定义负载,为nil时使用默认负载
+func (s *websocketSession) pingPayload() []byte {
+	f := s.getControlHandles().pingPayload
+	if f == nil {
+		return nil
+	}
+	payload := f(s.GetId())
+	if len(payload) > 125 {
+		payload = payload[0:125]
+	}
+	return payload
+}
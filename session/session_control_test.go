@@ -0,0 +1,85 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_SessionPingCallBack(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{
+		PingCallBackHandle: func(id int64, payload []byte) ([]byte, bool) {
+			if string(payload) == "quiet" {
+				return nil, false
+			}
+			return append([]byte("re:"), payload...), true
+		},
+	})
+	// 自定义回复
+	writePeerFrame(t, peer, 0x01, 0x09, []byte("hello"))
+	if f := readPeerFrame(t, peer); f.Opcode != 0x0A || string(f.PayloadData) != "re:hello" {
+		t.Fatal("pong: ", f.Opcode, string(f.PayloadData))
+	}
+	// ok为false时不回复
+	writePeerFrame(t, peer, 0x01, 0x09, []byte("quiet"))
+	peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := peer.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Fatal("suppressed pong sent: ", err)
+	}
+	// 清除回调后以相同的负载回复
+	sess.SetPingCallBack(nil)
+	writePeerFrame(t, peer, 0x01, 0x09, []byte("quiet"))
+	if f := readPeerFrame(t, peer); f.Opcode != 0x0A || string(f.PayloadData) != "quiet" {
+		t.Fatal("default pong: ", f.Opcode, string(f.PayloadData))
+	}
+}
+
+func Test_SessionPongCallBack(t *testing.T) {
+	pongs := make(chan string, 1)
+	_, peer, _ := newPipeSession(t, &ConfigureSession{
+		PongCallBackHandle: func(id int64, payload []byte) {
+			pongs <- string(payload)
+		},
+	})
+	writePeerFrame(t, peer, 0x01, 0x0A, []byte("unsolicited"))
+	select {
+	case p := <-pongs:
+		if p != "unsolicited" {
+			t.Fatal("pong payload: ", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pong callback timeout")
+	}
+}
+
+func Test_SessionPingPayload(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 200)
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{
+		Heartbeat:         &Heartbeat{Interval: 50 * time.Millisecond},
+		PingPayloadHandle: func(id int64) []byte { return long },
+	})
+	// 超过125字节时截断
+	f := readPeerFrame(t, peer)
+	if f.Opcode != 0x09 || !bytes.Equal(f.PayloadData, long[:125]) {
+		t.Fatal("ping: ", f.Opcode, len(f.PayloadData))
+	}
+	writePeerFrame(t, peer, 0x01, 0x0A, f.PayloadData)
+	deadline := time.Now().Add(time.Second)
+	for sess.GetHeartbeatStats().Received != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("custom pong not matched: %+v", sess.GetHeartbeatStats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 返回nil时使用默认负载
+	sess.SetPingPayloadHandle(func(id int64) []byte { return nil })
+	for {
+		f = readPeerFrame(t, peer)
+		if !bytes.Equal(f.PayloadData, long[:125]) {
+			break
+		}
+	}
+	if f.Opcode != 0x09 || len(f.PayloadData) != heartbeatPayloadLength {
+		t.Fatal("default ping: ", f.Opcode, len(f.PayloadData))
+	}
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+/*
+HandshakeInfo           握手请求的只读快照
+  - URL                 请求的url(客户端为链接的url)
+  - Host                请求的Host
+  - Header              服务端为请求头,客户端为响应头
+  - RemoteAddr          对端地址
+  - LocalAddr           本端地址
+  - ClientIP            客户端ip,服务端来自受信任的代理时为转发的ip
+  - Subprotocol         协商后的子协议(Sec-WebSocket-Protocol)
+*/
+type HandshakeInfo struct {
+	URL         *url.URL
+	Host        string
+	Header      http.Header
+	RemoteAddr  string
+	LocalAddr   string
+	ClientIP    string
+	Subprotocol string
+}
+
+// clone         深拷贝,保证快照只读
+func (h HandshakeInfo) clone() HandshakeInfo {
+	if h.URL != nil {
+		u := *h.URL
+		if h.URL.User != nil {
+			user := *h.URL.User
+			u.User = &user
+		}
+		h.URL = &u
+	}
+	h.Header = h.Header.Clone()
+	return h
+}
+
+// NewHandshakeInfo     从请求生成握手快照
+func NewHandshakeInfo(req *http.Request, subprotocol string) *HandshakeInfo {
+	if req == nil {
+		return nil
+	}
+	info := HandshakeInfo{
+		URL:         req.URL,
+		Host:        req.Host,
+		Header:      req.Header,
+		RemoteAddr:  req.RemoteAddr,
+		Subprotocol: subprotocol,
+	}
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		info.LocalAddr = addr.String()
+	}
+	info = info.clone()
+	return &info
+}
+
+func (s *websocketSession) GetHandshake() HandshakeInfo {
+	return s.handshake.clone()
+}
+
+func (s *websocketSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *websocketSession) Set(key string, value interface{}) {
+	s.valueMu.Lock()
+	defer s.valueMu.Unlock()
+	if s.values == nil {
+		s.values = map[string]interface{}{}
+	}
+	s.values[key] = value
+}
+
+func (s *websocketSession) Get(key string) (interface{}, bool) {
+	s.valueMu.RLock()
+	defer s.valueMu.RUnlock()
+	value, ok := s.values[key]
+	return value, ok
+}
+
+func (s *websocketSession) Del(key string) {
+	s.valueMu.Lock()
+	defer s.valueMu.Unlock()
+	delete(s.values, key)
+}
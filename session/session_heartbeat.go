@@ -0,0 +1,156 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// heartbeatPayloadLength    心跳ping的默认负载长度:8字节序号+8字节发送时间(纳秒)
+const heartbeatPayloadLength = 16
+
+/*
+Heartbeat                   心跳配置,定时发送ping帧,并根据pong帧计算往返时间(RTT)
+  - Interval                发送ping帧的间隔,<=0:关闭
+  - MaxMissed               连续未收到pong的次数,超过时以 CloseHartTimeOut 断开,<1:不断开
+*/
+type Heartbeat struct {
+	Interval  time.Duration
+	MaxMissed int
+}
+
+/*
+HeartbeatStats              心跳统计
+  - Sent                    发送的ping数
+  - Received                收到的匹配的pong数
+  - Missed                  当前连续未收到pong的次数
+  - LastRTT                 最近一次的往返时间
+  - AvgRTT                  平均往返时间
+  - MinRTT                  最小往返时间
+  - MaxRTT                  最大往返时间
+*/
+type HeartbeatStats struct {
+	Sent     uint64
+	Received uint64
+	Missed   int
+	LastRTT  time.Duration
+	AvgRTT   time.Duration
+	MinRTT   time.Duration
+	MaxRTT   time.Duration
+}
+
+// heartbeat          session的心跳状态
+type heartbeat struct {
+	mu       sync.Mutex
+	conf     Heartbeat
+	seq      uint64
+	acked    bool
+	payload  []byte
+	sentAt   time.Time
+	stats    HeartbeatStats
+	totalRTT time.Duration
+}
+
+func newHeartbeat(conf Heartbeat) *heartbeat {
+	if conf.Interval <= 0 {
+		return nil
+	}
+	return &heartbeat{conf: conf, acked: true}
+}
+
+// next              生成下一个ping的负载,custom不为nil时使用custom;上一个ping未收到pong时计为一次丢失,返回是否超过最大丢失数
+func (h *heartbeat) next(custom []byte) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.acked {
+		h.stats.Missed++
+		if h.conf.MaxMissed > 0 && h.stats.Missed >= h.conf.MaxMissed {
+			return nil, false
+		}
+	}
+	h.seq++
+	h.acked = false
+	h.stats.Sent++
+	h.sentAt = time.Now()
+	if custom != nil {
+		h.payload = custom
+	} else {
+		h.payload = make([]byte, heartbeatPayloadLength)
+		binary.BigEndian.PutUint64(h.payload[0:8], h.seq)
+		binary.BigEndian.PutUint64(h.payload[8:16], uint64(h.sentAt.UnixNano()))
+	}
+	return h.payload, true
+}
+
+// onPong            处理pong帧,负载与最近一次ping相同时计算RTT
+func (h *heartbeat) onPong(payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.acked || !bytes.Equal(payload, h.payload) {
+		return
+	}
+	rtt := time.Since(h.sentAt)
+	h.acked = true
+	h.stats.Missed = 0
+	h.stats.Received++
+	h.stats.LastRTT = rtt
+	h.totalRTT += rtt
+	h.stats.AvgRTT = h.totalRTT / time.Duration(h.stats.Received)
+	if h.stats.MinRTT == 0 || rtt < h.stats.MinRTT {
+		h.stats.MinRTT = rtt
+	}
+	if rtt > h.stats.MaxRTT {
+		h.stats.MaxRTT = rtt
+	}
+}
+
+/*
+heartbeatLoop            心跳goroutine,在 DoConnect 后启动,断开后退出
+  - ping帧交给写入goroutine,写入阻塞时不等待,下一次计时以新的ping代替未提交的ping
+  - 超过最大丢失数时直接关闭链接,不依赖写入goroutine
+*/
+func (s *websocketSession) heartbeatLoop() {
+	ticker := time.NewTicker(s.heartbeat.conf.Interval)
+	defer ticker.Stop()
+	var pending chan writeRequest // 有未提交的ping时为 writeChan
+	var ping writeRequest
+	for {
+		select {
+		case <-s.done:
+			return
+		case pending <- ping:
+			pending = nil
+		case <-ticker.C:
+			payload, ok := s.heartbeat.next(s.pingPayload())
+			if !ok {
+				s.doHeartbeatTimeOut()
+				return
+			}
+			bufs, err := s.codec.EncodeMessageBuffers(9, payload)
+			if err != nil {
+				continue
+			}
+			ping = writeRequest{bufs: bufs, flush: true, result: make(chan writeResult, 1)}
+			pending = s.writeChan
+		}
+	}
+}
+
+// doHeartbeatTimeOut       对端已无响应,发送关闭帧后直接关闭链接,不再等待对端回复关闭帧
+func (s *websocketSession) doHeartbeatTimeOut() {
+	if _, ok := s.startClosing(CloseHartTimeOut); ok {
+		s.sendClose(CloseHartTimeOut)
+	}
+	s.close(CloseHartTimeOut)
+	s.conn.Close()
+}
+
+func (s *websocketSession) GetHeartbeatStats() HeartbeatStats {
+	if s.heartbeat == nil {
+		return HeartbeatStats{}
+	}
+	s.heartbeat.mu.Lock()
+	defer s.heartbeat.mu.Unlock()
+	return s.heartbeat.stats
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_HeartbeatPongMatch(t *testing.T) {
+	h := newHeartbeat(Heartbeat{Interval: time.Second, MaxMissed: 3})
+	p1, _ := h.next(nil)
+	time.Sleep(5 * time.Millisecond)
+	// 负载不同的pong被忽略
+	h.onPong([]byte("foreign"))
+	if h.stats.Received != 0 {
+		t.Fatal("foreign pong counted")
+	}
+	h.onPong(p1)
+	if h.stats.Received != 1 || h.stats.LastRTT < 5*time.Millisecond {
+		t.Fatalf("stats: %+v", h.stats)
+	}
+	// 重复的pong被忽略
+	h.onPong(p1)
+	if h.stats.Received != 1 {
+		t.Fatal("duplicate pong counted")
+	}
+	p2, _ := h.next(nil)
+	p3, _ := h.next(nil)
+	if bytes.Equal(p2, p3) || h.stats.Missed != 1 {
+		t.Fatalf("missed ping: %+v", h.stats)
+	}
+	// 过期的pong(上一个ping的负载)被忽略
+	h.onPong(p2)
+	if h.stats.Received != 1 || h.stats.Missed != 1 {
+		t.Fatalf("stale pong: %+v", h.stats)
+	}
+	h.onPong(p3)
+	s := h.stats
+	if s.Sent != 3 || s.Received != 2 || s.Missed != 0 {
+		t.Fatalf("stats: %+v", s)
+	}
+	if s.MinRTT > s.MaxRTT || s.AvgRTT != (s.MinRTT+s.MaxRTT)/2 || s.LastRTT > s.MaxRTT {
+		t.Fatalf("rtt: %+v", s)
+	}
+	// 自定义负载
+	if p, _ := h.next([]byte("custom")); string(p) != "custom" {
+		t.Fatal("custom payload: ", string(p))
+	}
+	h.onPong([]byte("custom"))
+	if h.stats.Received != 3 {
+		t.Fatal("custom pong not matched")
+	}
+	// 连续丢失 MaxMissed 次
+	for i := 0; i < 3; i++ {
+		if _, ok := h.next(nil); !ok {
+			t.Fatal("timeout too early: ", i)
+		}
+	}
+	if _, ok := h.next(nil); ok {
+		t.Fatal("MaxMissed not reached")
+	}
+	if newHeartbeat(Heartbeat{}) != nil {
+		t.Fatal("heartbeat without interval")
+	}
+}
+
+func Test_SessionHeartbeatStats(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{Heartbeat: &Heartbeat{Interval: 200 * time.Millisecond, MaxMissed: 2}})
+	const delay = 10 * time.Millisecond
+	for i := 0; i < 4; i++ {
+		f := readPeerFrame(t, peer)
+		if f.Opcode != 0x09 || len(f.PayloadData) != heartbeatPayloadLength {
+			t.Fatal("ping: ", f.Opcode, len(f.PayloadData))
+		}
+		time.Sleep(delay)
+		// 其它负载的pong不计入
+		writePeerFrame(t, peer, 0x01, 0x0A, []byte("foreign"))
+		writePeerFrame(t, peer, 0x01, 0x0A, f.PayloadData)
+	}
+	deadline := time.Now().Add(time.Second)
+	for sess.GetHeartbeatStats().Received != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats: %+v", sess.GetHeartbeatStats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s := sess.GetHeartbeatStats()
+	if s.Sent != 4 || s.Missed != 0 {
+		t.Fatalf("stats: %+v", s)
+	}
+	if s.MinRTT < delay || s.MaxRTT < s.MinRTT || s.AvgRTT < s.MinRTT || s.AvgRTT > s.MaxRTT || s.LastRTT < delay {
+		t.Fatalf("rtt: %+v", s)
+	}
+}
@@ -39,7 +39,8 @@ type sessionIdManager struct {
 	u32      uint32     // 顺序的uint32
 }
 
-func (id *sessionIdManager) next() {
+// next        生成下一个id,在锁内返回秒级时间与顺序号
+func (id *sessionIdManager) next() (int64, uint32) {
 	id.mu.Lock()
 	defer id.mu.Unlock()
 	t := time.Now().Unix()
@@ -54,12 +55,13 @@ func (id *sessionIdManager) next() {
 			id.u32 += 1
 		}
 	}
+	return id.timeUnix, id.u32
 }
 func (id *sessionIdManager) GetInt() int64 {
-	id.next()
-	return int64(id.u32)*10000000000 + id.timeUnix
+	timeUnix, u32 := id.next()
+	return int64(u32)*10000000000 + timeUnix
 }
 func (id *sessionIdManager) GetString() string {
-	id.next()
-	return fmt.Sprintf("%d%010d", id.timeUnix, id.u32)
+	timeUnix, u32 := id.next()
+	return fmt.Sprintf("%d%010d", timeUnix, u32)
 }
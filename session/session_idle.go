@@ -0,0 +1,67 @@
+package session
+
+import "time"
+
+/*
+IdlePolicy                  空闲超时策略,超时后以 CloseIdleTimeout(3004) 断开
+  - Timeout                 空闲超时,<=0:不限制
+  - CountOutbound           发送的帧是否也算作活动,默认只计算接收的帧(包括ping,pong)
+*/
+type IdlePolicy struct {
+	Timeout       time.Duration
+	CountOutbound bool
+}
+
+// startIdle        开始空闲计时
+func (s *websocketSession) startIdle() {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idle.Timeout > 0 && s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(s.idle.Timeout, s.doIdleTimeOut)
+	}
+}
+
+// stopIdle         停止空闲计时
+func (s *websocketSession) stopIdle() {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+}
+
+// touchIdle        有活动时重置空闲计时,outbound为true表示发送的帧
+func (s *websocketSession) touchIdle(outbound bool) {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	if s.idleTimer == nil || (outbound && !s.idle.CountOutbound) {
+		return
+	}
+	s.idleTimer.Reset(s.idle.Timeout)
+}
+
+func (s *websocketSession) SetIdlePolicy(p IdlePolicy) {
+	s.idleMu.Lock()
+	s.idle = p
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+	start := s.started
+	s.idleMu.Unlock()
+	start = start && s.getStatus() == Connected
+	if start {
+		s.startIdle()
+	}
+}
+
+func (s *websocketSession) GetIdlePolicy() IdlePolicy {
+	s.idleMu.Lock()
+	defer s.idleMu.Unlock()
+	return s.idle
+}
+
+// doIdleTimeOut    空闲超时,断开链接
+func (s *websocketSession) doIdleTimeOut() {
+	s.DisConnect(CloseIdleTimeout)
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+const testIdleTimeout = 150 * time.Millisecond
+
+// expectIdleTimeOut      对端收到 CloseIdleTimeout 的关闭帧并回复,session以3004断开
+func expectIdleTimeOut(t *testing.T, peer net.Conn, closed chan Status, skip ...byte) {
+	if status := closeFrameStatus(t, readPeerFrame(t, peer, skip...)); status != CloseIdleTimeout {
+		t.Fatal("close frame status: ", status)
+	}
+	writePeerClose(t, peer, CloseNormalClosure)
+	if status := waitStatus(t, closed, time.Second); status != CloseIdleTimeout {
+		t.Fatal("status: ", status)
+	}
+}
+
+// expectOpen             session在d内没有断开
+func expectOpen(t *testing.T, closed chan Status, d time.Duration) {
+	select {
+	case status := <-closed:
+		t.Fatal("closed while active: ", status)
+	case <-time.After(d):
+	}
+}
+
+func Test_IdleControlFrames(t *testing.T) {
+	// 对端的ping,pong都算作活动
+	for _, opcode := range []byte{0x09, 0x0A} {
+		_, peer, closed := newPipeSession(t, &ConfigureSession{IdlePolicy: &IdlePolicy{Timeout: testIdleTimeout}})
+		start := time.Now()
+		for time.Since(start) < 3*testIdleTimeout {
+			writePeerFrame(t, peer, 0x01, opcode, []byte("keep"))
+			if opcode == 0x09 {
+				if f := readPeerFrame(t, peer); f.Opcode != 0x0A {
+					t.Fatal("pong opcode: ", f.Opcode)
+				}
+			}
+			expectOpen(t, closed, testIdleTimeout/3)
+		}
+		expectIdleTimeOut(t, peer, closed)
+	}
+}
+
+func Test_IdleCountOutbound(t *testing.T) {
+	for _, countOutbound := range []bool{false, true} {
+		sess, peer, closed := newPipeSession(t, &ConfigureSession{
+			IdlePolicy: &IdlePolicy{Timeout: testIdleTimeout, CountOutbound: countOutbound},
+		})
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(testIdleTimeout / 3):
+					sess.Write(1, []byte("out"))
+				}
+			}
+		}()
+		if !countOutbound {
+			// 只发送不接收时仍然超时
+			expectIdleTimeOut(t, peer, closed, 0x01)
+			close(stop)
+			continue
+		}
+		deadline := time.Now().Add(3 * testIdleTimeout)
+		for time.Now().Before(deadline) {
+			if f := readPeerFrame(t, peer); f.Opcode != 0x01 {
+				t.Fatal("closed while writing: ", f.Opcode)
+			}
+		}
+		close(stop)
+		expectIdleTimeOut(t, peer, closed, 0x01)
+	}
+}
+
+func Test_SetIdlePolicy(t *testing.T) {
+	sess, peer, closed := newPipeSession(t, nil)
+	expectOpen(t, closed, testIdleTimeout)
+	// 运行中配置空闲超时
+	sess.SetIdlePolicy(IdlePolicy{Timeout: testIdleTimeout})
+	expectIdleTimeOut(t, peer, closed)
+}
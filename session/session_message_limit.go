@@ -0,0 +1,35 @@
+package session
+
+/*
+MessageLimits                 接收消息的大小限制,超过限制时以 CloseMessageTooBig(1009) 断开
+  - MaxFrameSize              单个帧的最大负载,0:使用 CodecOptions.MaxFrameSize
+  - MaxMessageSize            合并分包后消息的最大长度,0:使用 CodecOptions.MaxMessageSize
+  - MaxFragments              一个消息的最大分包数,0:不限制
+*/
+type MessageLimits struct {
+	MaxFrameSize   uint64
+	MaxMessageSize uint64
+	MaxFragments   int
+}
+
+// effectiveLimits    返回生效的限制,未配置的项使用编解码器的配置
+func (s *websocketSession) effectiveLimits() MessageLimits {
+	l := s.GetMessageLimits()
+	opt := s.codec.Options()
+	if l.MaxFrameSize == 0 {
+		l.MaxFrameSize = opt.MaxFrameSize
+	}
+	if l.MaxMessageSize == 0 {
+		l.MaxMessageSize = opt.MaxMessageSize
+	}
+	return l
+}
+
+func (s *websocketSession) SetMessageLimits(l MessageLimits) {
+	s.messageLimits.Store(l)
+}
+
+func (s *websocketSession) GetMessageLimits() MessageLimits {
+	l, _ := s.messageLimits.Load().(MessageLimits)
+	return l
+}
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"github.com/qdmc/websocket_packet/frame"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testMessageBytes       按分包长度生成一个分包消息
+func testMessageBytes(t *testing.T, sizes ...int) []byte {
+	var bs []byte
+	for i, size := range sizes {
+		fin, opcode := byte(0x00), byte(0x00)
+		if i == 0 {
+			opcode = 0x02
+		}
+		if i == len(sizes)-1 {
+			fin = 0x01
+		}
+		bs = append(bs, testPeerFragmentBytes(t, fin, opcode, make([]byte, size))...)
+	}
+	return bs
+}
+
+// expectTooBig           对端收到 CloseMessageTooBig 的关闭帧,session以1009断开
+func expectTooBig(t *testing.T, name string, peer net.Conn, closed chan Status) {
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != frame.CloseMessageTooBig {
+		t.Fatalf("%s: close frame status %d", name, status)
+	}
+	if status := waitStatus(t, closed, time.Second); status != frame.CloseMessageTooBig {
+		t.Fatalf("%s: status %d", name, status)
+	}
+}
+
+func Test_MessageLimits(t *testing.T) {
+	cases := []struct {
+		name   string
+		limits *MessageLimits
+		codec  *frame.CodecOptions
+		sizes  []int
+	}{
+		{"frame size", &MessageLimits{MaxFrameSize: 10}, nil, []int{11}},
+		{"message size", &MessageLimits{MaxMessageSize: 10}, nil, []int{11}},
+		{"fragmented message size", &MessageLimits{MaxMessageSize: 10}, nil, []int{6, 5}},
+		{"fragments", &MessageLimits{MaxFragments: 2}, nil, []int{1, 1, 1}},
+		{"codec message size", nil, &frame.CodecOptions{MaxMessageSize: 10}, []int{4, 4, 4}},
+	}
+	for _, stream := range []bool{false, true} {
+		for _, c := range cases {
+			opt := &ConfigureSession{MessageLimits: c.limits, Codec: c.codec}
+			if stream {
+				opt.StreamCallBackHandle = func(id int64, opcode byte, r io.Reader) {
+					io.Copy(io.Discard, r)
+				}
+			}
+			_, peer, closed := newPipeSession(t, opt)
+			go peer.Write(testMessageBytes(t, c.sizes...))
+			expectTooBig(t, c.name, peer, closed)
+		}
+	}
+}
+
+func Test_MessageLimitsWithin(t *testing.T) {
+	received := make(chan int, 1)
+	sess, peer, closed := newPipeSession(t, &ConfigureSession{
+		MessageLimits:       &MessageLimits{MaxMessageSize: 10, MaxFragments: 2},
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) { received <- len(payload) },
+	})
+	go peer.Write(testMessageBytes(t, 5, 5))
+	select {
+	case n := <-received:
+		if n != 10 {
+			t.Fatal("message length: ", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message within limits not delivered")
+	}
+	// SetMessageLimits 立即生效
+	sess.SetMessageLimits(MessageLimits{MaxMessageSize: 4})
+	go peer.Write(testMessageBytes(t, 5))
+	expectTooBig(t, "SetMessageLimits", peer, closed)
+}
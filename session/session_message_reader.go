@@ -0,0 +1,202 @@
+package session
+
+import (
+	"errors"
+	"github.com/qdmc/websocket_packet/frame"
+	"io"
+	"sync"
+)
+
+// errAbandoned               消息已被放弃
+var errAbandoned = errors.New("message reader is abandoned")
+
+// StreamCallBackHandle       以流的方式接收消息的回调,分包到达时即可读取;回调返回后,消息未读取的部分被丢弃;读取过慢的影响见 messageReader
+type StreamCallBackHandle func(id int64, opcode byte, r io.Reader)
+
+/*
+messageReader                 流式消息读取器
+  - 读取goroutine每次只交付一个分包,分包被读取完之前,读取goroutine不再读取链接(背压)
+  - 被放弃(回调返回,或拉取下一个消息)后,剩余的分包直接丢弃
+  - 分包(或拉取模式下的消息)未被读取时,读取goroutine停止读取链接,期间也不处理控制帧,不回复ping,不处理pong;
+    配置了 Heartbeat 时,消费过慢超过 MaxMissed 个心跳间隔会被当作对端无响应,以 CloseHartTimeOut 断开
+*/
+type messageReader struct {
+	s           *websocketSession
+	opcode      byte
+	chunks      chan *frame.Frame
+	abandoned   chan struct{}
+	abandonOnce sync.Once
+	cur         *frame.Frame
+	buf         []byte
+}
+
+func newMessageReader(s *websocketSession, opcode byte) *messageReader {
+	return &messageReader{
+		s:         s,
+		opcode:    opcode,
+		chunks:    make(chan *frame.Frame),
+		abandoned: make(chan struct{}),
+	}
+}
+
+func (r *messageReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.cur != nil {
+			r.cur.Release()
+			r.cur = nil
+		}
+		f, ok, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, io.EOF
+		}
+		r.cur, r.buf = f, f.PayloadData
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// next          等待下一个分包,消息结束时返回false
+func (r *messageReader) next() (*frame.Frame, bool, error) {
+	// 放弃后剩余的分包被丢弃,chunks 关闭也不能当作消息已读取完成
+	select {
+	case <-r.abandoned:
+		return nil, false, errAbandoned
+	default:
+	}
+	select {
+	case f, ok := <-r.chunks:
+		return f, ok, nil
+	case <-r.abandoned:
+		return nil, false, errAbandoned
+	case <-r.s.done:
+		// 分包不缓冲,断开后不会再有分包;消息在断开前已结束(chunks已关闭)时返回 io.EOF
+		select {
+		case f, ok := <-r.chunks:
+			return f, ok, nil
+		default:
+			return nil, false, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// push          交付一个分包,等待读取或放弃
+func (r *messageReader) push(f *frame.Frame) {
+	select {
+	case r.chunks <- f:
+	case <-r.abandoned:
+		f.Release()
+	case <-r.s.done:
+		f.Release()
+	}
+}
+
+// finish        消息结束
+func (r *messageReader) finish() {
+	close(r.chunks)
+}
+
+// abandon       放弃未读取的部分
+func (r *messageReader) abandon() {
+	r.abandonOnce.Do(func() {
+		close(r.abandoned)
+	})
+}
+
+// readStream    以流的方式处理数据帧
+func (s *websocketSession) readStream(f *frame.Frame, limits MessageLimits) (Status, bool) {
+	// 数据帧开始新消息时不能有未完成的分包,延续帧必须有未完成的分包
+	if (f.Opcode == 0) != s.streaming {
+		f.Release()
+		return frame.CloseProtocolError, false
+	}
+	if f.Opcode != 0 {
+		s.streaming = true
+		s.streamLen = 0
+		s.fragments = 0
+		s.stream = nil
+		if ok, status := s.rateLimiter.allow(false, len(f.PayloadData)); !ok {
+			if status != CloseNormalClosure {
+				f.Release()
+				return status, false
+			}
+			// 丢弃整个消息
+		} else {
+			s.stream = newMessageReader(s, f.Opcode)
+			if !s.deliverStream(s.stream) {
+				f.Release()
+				return CloseReadConnFailed, false
+			}
+		}
+	}
+	s.fragments++
+	s.streamLen += uint64(len(f.PayloadData))
+	if limits.MaxFragments > 0 && s.fragments > limits.MaxFragments {
+		f.Release()
+		return frame.CloseMessageTooBig, false
+	}
+	if limits.MaxMessageSize > 0 && s.streamLen > limits.MaxMessageSize {
+		f.Release()
+		return frame.CloseMessageTooBig, false
+	}
+	fin := f.Fin == 0x01
+	if s.stream != nil {
+		s.stream.push(f)
+	} else {
+		f.Release()
+	}
+	if fin {
+		if s.stream != nil {
+			s.stream.finish()
+		}
+		s.stream = nil
+		s.streaming = false
+		s.fragments = 0
+	}
+	return CloseNormalClosure, true
+}
+
+// deliverStream      交付一个新消息:回调模式下在新的goroutine中回调,拉取模式下等待 NextReader;断开时返回false
+func (s *websocketSession) deliverStream(r *messageReader) bool {
+	if s.streamCb != nil {
+		go func() {
+			defer r.abandon()
+			s.streamCb(s.GetId(), r.opcode, r)
+		}()
+		return true
+	}
+	select {
+	case s.nextChan <- r:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+/*
+NextReader            拉取模式下,等待并返回下一个消息的opcode及读取器
+  - 只能在 ConfigureSession.PullMode 为true时使用,且同时只能有一个goroutine调用
+  - 调用时放弃上一个消息未读取的部分
+  - 没有调用 NextReader 或未读取完消息时,读取goroutine一直等待(背压),见 messageReader
+*/
+func (s *websocketSession) NextReader() (byte, io.Reader, error) {
+	if !s.pullMode {
+		return 0, nil, errors.New("session is not in pull mode")
+	}
+	s.pullMu.Lock()
+	defer s.pullMu.Unlock()
+	if s.lastReader != nil {
+		s.lastReader.abandon()
+		s.lastReader = nil
+	}
+	select {
+	case r := <-s.nextChan:
+		s.lastReader = r
+		return r.opcode, r, nil
+	case <-s.done:
+		return 0, nil, errNotConnected
+	}
+}
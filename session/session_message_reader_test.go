@@ -0,0 +1,121 @@
+package session
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// writePeerFragments     对端以size分包写入一个消息,在goroutine中执行,写入阻塞时不影响测试
+func writePeerFragments(t *testing.T, peer net.Conn, opcode byte, payload []byte, size int) {
+	var bs []byte
+	for i := 0; i < len(payload); i += size {
+		end := i + size
+		fin := byte(0x00)
+		if end >= len(payload) {
+			end, fin = len(payload), 0x01
+		}
+		op := byte(0x00)
+		if i == 0 {
+			op = opcode
+		}
+		bs = append(bs, testPeerFragmentBytes(t, fin, op, payload[i:end])...)
+	}
+	go peer.Write(bs)
+}
+
+func Test_StreamCallBack(t *testing.T) {
+	received := make(chan string, 1)
+	_, peer, _ := newPipeSession(t, &ConfigureSession{
+		StreamCallBackHandle: func(id int64, opcode byte, r io.Reader) {
+			bs, err := io.ReadAll(r)
+			if err != nil || opcode != 0x01 {
+				received <- "readErr"
+				return
+			}
+			received <- string(bs)
+		},
+	})
+	writePeerFragments(t, peer, 0x01, []byte("hello stream"), 3)
+	select {
+	case msg := <-received:
+		if msg != "hello stream" {
+			t.Fatal("message: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream timeout")
+	}
+}
+
+func Test_NextReaderAbandon(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{PullMode: true})
+	writePeerFragments(t, peer, 0x01, []byte("first message"), 5)
+	opcode, r1, err := sess.NextReader()
+	if err != nil || opcode != 0x01 {
+		t.Fatal("nextReaderErr: ", err, " opcode: ", opcode)
+	}
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(r1, buf); err != nil || string(buf) != "fir" {
+		t.Fatal("read: ", string(buf), err)
+	}
+	// 拉取下一个消息时放弃上一个消息剩余的分包
+	writePeerFragments(t, peer, 0x02, []byte("second"), 4)
+	opcode, r2, err := sess.NextReader()
+	if err != nil || opcode != 0x02 {
+		t.Fatal("nextReaderErr: ", err, " opcode: ", opcode)
+	}
+	if bs, err := io.ReadAll(r2); err != nil || string(bs) != "second" {
+		t.Fatal("second: ", string(bs), err)
+	}
+	// 已交付的分包仍可读完,之后返回错误
+	if bs, err := io.ReadAll(r1); err == nil || string(bs) != "st" {
+		t.Fatal("abandoned reader: ", string(bs), err)
+	}
+	if _, _, err = (&websocketSession{}).NextReader(); err == nil {
+		t.Fatal("NextReader without PullMode should fail")
+	}
+}
+
+func Test_NextReaderBackpressure(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{PullMode: true})
+	bs := testPeerFragmentBytes(t, 0x01, 0x01, []byte("pending"))
+	go peer.Write(append(bs, testPeerFragmentBytes(t, 0x01, 0x09, []byte("ping"))...))
+	// 消息未被拉取时不再读取链接,ping也不会回复
+	peer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := peer.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Fatal("read while blocked: ", err)
+	}
+	_, r, err := sess.NextReader()
+	if err != nil {
+		t.Fatal("nextReaderErr: ", err.Error())
+	}
+	if bs, _ := io.ReadAll(r); string(bs) != "pending" {
+		t.Fatal("message: ", string(bs))
+	}
+	if f := readPeerFrame(t, peer); f.Opcode != 0x0A || string(f.PayloadData) != "ping" {
+		t.Fatal("pong: ", f.Opcode, string(f.PayloadData))
+	}
+}
+
+func Test_NextReaderDisConnect(t *testing.T) {
+	sess, peer, closed := newPipeSession(t, &ConfigureSession{PullMode: true})
+	// 只发送第一个分包
+	go peer.Write(testPeerFragmentBytes(t, 0x00, 0x01, []byte("part")))
+	_, r, err := sess.NextReader()
+	if err != nil {
+		t.Fatal("nextReaderErr: ", err.Error())
+	}
+	buf := make([]byte, 4)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		t.Fatal("readErr: ", err.Error())
+	}
+	peer.Close()
+	waitStatus(t, closed, time.Second)
+	if _, err = r.Read(buf); err != io.ErrUnexpectedEOF {
+		t.Fatal("read after disconnect: ", err)
+	}
+	if _, _, err = sess.NextReader(); err == nil {
+		t.Fatal("NextReader after disconnect should fail")
+	}
+}
@@ -0,0 +1,128 @@
+package session
+
+import (
+	"errors"
+	"github.com/qdmc/websocket_packet/frame"
+	"io"
+)
+
+// DefaultFragmentSize     NextWriter 默认的分包大小,CodecOptions.FragmentSize 未配置时使用
+const DefaultFragmentSize = 64 << 10
+
+// errWriterClosed         消息写入器已关闭
+var errWriterClosed = errors.New("message writer is closed")
+
+// lockData        获取数据帧的写入权,断开后返回错误(写入权空闲时也返回错误)
+func (s *websocketSession) lockData() error {
+	select {
+	case <-s.done:
+		return errNotConnected
+	default:
+	}
+	select {
+	case <-s.done:
+		return errNotConnected
+	case s.dataSem <- struct{}{}:
+		return nil
+	}
+}
+
+// unlockData      释放数据帧的写入权
+func (s *websocketSession) unlockData() {
+	<-s.dataSem
+}
+
+/*
+NextWriter             以流的方式发送一个消息,数据按分包大小发送,Close 时发送最后一个分包(FIN)
+  - opcode             消息类型,1:text;2:binary
+  - 在 Close 之前,其它数据帧(Write 及其它 NextWriter)会等待,控制帧(ping,pong,close)可以穿插发送
+  - 在 Close 之前,同一个goroutine不能再调用 Write 发送数据帧,否则会死锁
+*/
+func (s *websocketSession) NextWriter(opcode byte) (io.WriteCloser, error) {
+	if opcode != 1 && opcode != 2 {
+		return nil, errors.New("opcode must be in 1,2")
+	}
+	if err := s.lockData(); err != nil {
+		return nil, err
+	}
+	size := s.codecOptions.FragmentSize
+	if size <= 0 || size > frame.PayloadMaxLength {
+		size = DefaultFragmentSize
+	}
+	return &messageWriter{s: s, opcode: opcode, size: size}, nil
+}
+
+// messageWriter    流式消息写入器
+type messageWriter struct {
+	s      *websocketSession
+	opcode byte // 下一个帧的opcode,发送第一个帧后为0(延续帧)
+	size   int
+	buf    []byte
+	closed bool
+	err    error
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		// 没有缓冲的数据时,直接发送完整的分包,不复制到缓冲区
+		if len(w.buf) == 0 && len(p) >= w.size {
+			if err := w.writeFrame(p[:w.size], false); err != nil {
+				return n - len(p), err
+			}
+			p = p[w.size:]
+			continue
+		}
+		if w.buf == nil {
+			w.buf = make([]byte, 0, w.size)
+		}
+		c := copy(w.buf[len(w.buf):w.size], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		if len(w.buf) == w.size {
+			if err := w.writeFrame(w.buf, false); err != nil {
+				return n - len(p), err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Close            发送最后一个分包,并释放数据帧的写入权
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+	defer w.s.unlockData()
+	if w.err != nil {
+		return w.err
+	}
+	return w.writeFrame(w.buf, true)
+}
+
+func (w *messageWriter) writeFrame(payload []byte, fin bool) error {
+	f := new(frame.Frame)
+	f.SetOpcode(w.opcode)
+	if fin {
+		f.SetFin(0x01)
+	}
+	f.SetPayload(payload)
+	bufs, err := w.s.codec.EncodeFrameBuffers(f)
+	if err == nil {
+		_, err = w.s.enqueue(bufs, false)
+	}
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.opcode = 0
+	return nil
+}
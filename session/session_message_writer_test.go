@@ -0,0 +1,130 @@
+package session
+
+import (
+	"github.com/qdmc/websocket_packet/frame"
+	"net"
+	"testing"
+	"time"
+)
+
+// testFragment     期望的分包
+type testFragment struct {
+	fin     byte
+	opcode  byte
+	payload string
+}
+
+// expectFragments  对端按顺序读取分包,并与期望的分包比较
+func expectFragments(t *testing.T, peer net.Conn, want ...testFragment) {
+	for i, w := range want {
+		f := readPeerFrame(t, peer)
+		if f.Fin != w.fin || f.Opcode != w.opcode || string(f.PayloadData) != w.payload {
+			t.Fatalf("fragment %d: got fin=%d opcode=%d payload=%q, want %+v", i, f.Fin, f.Opcode, f.PayloadData, w)
+		}
+	}
+}
+
+func Test_NextWriterFragments(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{Codec: &frame.CodecOptions{FragmentSize: 4}})
+	errs := make(chan error, 1)
+	go func() {
+		w, err := sess.NextWriter(1)
+		if err == nil {
+			w.Write([]byte("ab"))
+			w.Write([]byte("cdefghij"))
+			err = w.Close()
+		}
+		errs <- err
+	}()
+	expectFragments(t, peer,
+		testFragment{0x00, 0x01, "abcd"},
+		testFragment{0x00, 0x00, "efgh"},
+		testFragment{0x01, 0x00, "ij"},
+	)
+	if err := <-errs; err != nil {
+		t.Fatal("writerErr: ", err.Error())
+	}
+	// 数据正好是分包大小的整数倍时,最后一个分包为空
+	go func() {
+		w, err := sess.NextWriter(2)
+		if err == nil {
+			w.Write([]byte("12345678"))
+			err = w.Close()
+		}
+		errs <- err
+	}()
+	expectFragments(t, peer,
+		testFragment{0x00, 0x02, "1234"},
+		testFragment{0x00, 0x00, "5678"},
+		testFragment{0x01, 0x00, ""},
+	)
+	if err := <-errs; err != nil {
+		t.Fatal("writerErr: ", err.Error())
+	}
+	if _, err := sess.NextWriter(9); err == nil {
+		t.Fatal("control opcode should fail")
+	}
+}
+
+func Test_NextWriterBlocksWrite(t *testing.T) {
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{Codec: &frame.CodecOptions{FragmentSize: 4}})
+	w, err := sess.NextWriter(1)
+	if err != nil {
+		t.Fatal("nextWriterErr: ", err.Error())
+	}
+	wrote := make(chan struct{})
+	go func() {
+		w.Write([]byte("abcd"))
+		close(wrote)
+	}()
+	expectFragments(t, peer, testFragment{0x00, 0x01, "abcd"})
+	<-wrote
+	// Close 之前,其它数据帧等待
+	written := make(chan error, 1)
+	go func() {
+		_, err := sess.Write(1, []byte("other"))
+		written <- err
+	}()
+	select {
+	case <-written:
+		t.Fatal("Write not blocked by NextWriter")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// 控制帧可以穿插在分包之间
+	go sess.Write(9, []byte("ping"))
+	expectFragments(t, peer, testFragment{0x01, 0x09, "ping"})
+	go w.Close()
+	expectFragments(t, peer,
+		testFragment{0x01, 0x00, ""},
+		testFragment{0x00, 0x01, "othe"},
+		testFragment{0x01, 0x00, "r"},
+	)
+	if err = <-written; err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	if _, err = w.Write([]byte("late")); err != errWriterClosed {
+		t.Fatal("write after Close: ", err)
+	}
+	if err = w.Close(); err != errWriterClosed {
+		t.Fatal("second Close: ", err)
+	}
+}
+
+func Test_NextWriterDisConnect(t *testing.T) {
+	sess, peer, closed := newPipeSession(t, nil)
+	w, err := sess.NextWriter(2)
+	if err != nil {
+		t.Fatal("nextWriterErr: ", err.Error())
+	}
+	peer.Close()
+	waitStatus(t, closed, time.Second)
+	if _, err = w.Write(make([]byte, DefaultFragmentSize)); err == nil {
+		t.Fatal("write after disconnect should fail")
+	}
+	if err = w.Close(); err == nil {
+		t.Fatal("Close after disconnect should fail")
+	}
+	if _, err = sess.NextWriter(1); err == nil {
+		t.Fatal("NextWriter after disconnect should fail")
+	}
+}
@@ -0,0 +1,170 @@
+package session
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitAction     超过速率限制时的处理
+type RateLimitAction int
+
+const (
+	RateLimitDrop  RateLimitAction = iota // 丢弃消息(默认)
+	RateLimitDelay                        // 暂停读取,直到有足够的令牌(背压)
+	RateLimitClose                        // 以 ClosePolicyViolation(1008) 断开
+)
+
+/*
+RateLimit                    接收消息的速率限制(令牌桶),每个session独立计算, <=0:不限制
+  - MessagesPerSecond        每秒的数据消息数
+  - MessageBurst             数据消息数的突发上限,<1时等于 MessagesPerSecond
+  - BytesPerSecond           每秒的数据消息字节数
+  - ByteBurst                字节数的突发上限,<1时等于 BytesPerSecond
+  - ControlPerSecond         每秒的控制帧(ping,pong)数,关闭帧不受限制,以免丢弃对端的关闭帧
+  - ControlBurst             控制帧数的突发上限,<1时等于 ControlPerSecond
+  - Action                   超过限制时的处理
+*/
+type RateLimit struct {
+	MessagesPerSecond float64
+	MessageBurst      int
+	BytesPerSecond    float64
+	ByteBurst         int
+	ControlPerSecond  float64
+	ControlBurst      int
+	Action            RateLimitAction
+}
+
+// tokenBucket       令牌桶,只在读取的goroutine中使用
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b < 1 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// wait              补充令牌,返回取出n个令牌需要等待的时间,不取出令牌
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.last = now
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	n = b.limit(n)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take              取出n个令牌,令牌不足时预支,等待 wait 返回的时间后即可使用
+func (b *tokenBucket) take(n float64) {
+	if b == nil {
+		return
+	}
+	b.tokens -= b.limit(n)
+}
+
+// limit             单次超过突发上限时,按突发上限计算,避免永远等待
+func (b *tokenBucket) limit(n float64) float64 {
+	if n > b.burst {
+		return b.burst
+	}
+	return n
+}
+
+// rateLimiter       session的接收速率限制
+type rateLimiter struct {
+	action   RateLimitAction
+	messages *tokenBucket
+	bytes    *tokenBucket
+	control  *tokenBucket
+	dropped  uint64
+	delayed  uint64
+}
+
+func newRateLimiter(l *RateLimit) *rateLimiter {
+	if l == nil {
+		return nil
+	}
+	r := &rateLimiter{
+		action:   l.Action,
+		messages: newTokenBucket(l.MessagesPerSecond, l.MessageBurst),
+		bytes:    newTokenBucket(l.BytesPerSecond, l.ByteBurst),
+		control:  newTokenBucket(l.ControlPerSecond, l.ControlBurst),
+	}
+	if r.messages == nil && r.bytes == nil && r.control == nil {
+		return nil
+	}
+	return r
+}
+
+// allow             校验一个消息,返回false时丢弃消息;返回 ClosePolicyViolation 时断开;所有令牌桶都足够(或延迟)时才取出令牌,丢弃的消息不占用配额
+func (r *rateLimiter) allow(isControl bool, length int) (bool, Status) {
+	if r == nil {
+		return true, CloseNormalClosure
+	}
+	var wait time.Duration
+	if isControl {
+		wait = r.control.wait(1)
+	} else {
+		if w := r.messages.wait(1); w > wait {
+			wait = w
+		}
+		if w := r.bytes.wait(float64(length)); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		switch r.action {
+		case RateLimitDelay:
+		case RateLimitClose:
+			return false, CloseRateLimited
+		default:
+			atomic.AddUint64(&r.dropped, 1)
+			return false, CloseNormalClosure
+		}
+	}
+	if isControl {
+		r.control.take(1)
+	} else {
+		r.messages.take(1)
+		r.bytes.take(float64(length))
+	}
+	if wait > 0 {
+		atomic.AddUint64(&r.delayed, 1)
+		time.Sleep(wait)
+	}
+	return true, CloseNormalClosure
+}
+
+func (r *rateLimiter) getDropped() uint64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&r.dropped)
+}
+
+func (r *rateLimiter) getDelayed() uint64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&r.delayed)
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TokenBucket(t *testing.T) {
+	if newTokenBucket(0, 10) != nil {
+		t.Fatal("rate 0 should not limit")
+	}
+	var nilBucket *tokenBucket
+	if nilBucket.wait(100) != 0 {
+		t.Fatal("nil bucket should not wait")
+	}
+	b := newTokenBucket(100, 3)
+	for i := 0; i < 3; i++ {
+		if w := b.wait(1); w != 0 {
+			t.Fatalf("burst %d wait: %s", i, w)
+		}
+		b.take(1)
+	}
+	// wait 不取出令牌,重复调用的结果相同
+	w1 := b.wait(1)
+	w2 := b.wait(1)
+	if w1 <= 0 || w1 > 10*time.Millisecond || w2 > w1 {
+		t.Fatalf("wait: %s %s", w1, w2)
+	}
+	time.Sleep(15 * time.Millisecond)
+	if w := b.wait(1); w != 0 {
+		t.Fatal("not refilled: ", w)
+	}
+	// 单次超过突发上限时按突发上限计算
+	b = newTokenBucket(1000, 10)
+	if w := b.wait(1 << 20); w != 0 {
+		t.Fatal("oversized wait: ", w)
+	}
+	b.take(1 << 20)
+	if b.tokens != 0 {
+		t.Fatal("tokens: ", b.tokens)
+	}
+	// 突发上限未配置时等于速率
+	if b = newTokenBucket(5, 0); b.burst != 5 {
+		t.Fatal("burst: ", b.burst)
+	}
+}
+
+func Test_RateLimitDrop(t *testing.T) {
+	r := newRateLimiter(&RateLimit{MessagesPerSecond: 1, MessageBurst: 2, BytesPerSecond: 1, ByteBurst: 10})
+	// 字节数超限而丢弃的消息不占用消息数的配额
+	if ok, _ := r.allow(false, 8); !ok {
+		t.Fatal("first message dropped")
+	}
+	if ok, status := r.allow(false, 8); ok || status != CloseNormalClosure {
+		t.Fatal("oversized message allowed: ", status)
+	}
+	if ok, _ := r.allow(false, 2); !ok {
+		t.Fatal("message quota consumed by dropped message")
+	}
+	if ok, _ := r.allow(false, 0); ok {
+		t.Fatal("message quota not enforced")
+	}
+	if r.getDropped() != 2 || r.getDelayed() != 0 {
+		t.Fatal("dropped: ", r.getDropped(), " delayed: ", r.getDelayed())
+	}
+	// 控制帧使用单独的令牌桶
+	if newRateLimiter(&RateLimit{MessagesPerSecond: 1}).control != nil {
+		t.Fatal("control should not be limited")
+	}
+}
+
+func Test_RateLimitDelay(t *testing.T) {
+	r := newRateLimiter(&RateLimit{ControlPerSecond: 20, ControlBurst: 1, Action: RateLimitDelay})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, status := r.allow(true, 0); !ok || status != CloseNormalClosure {
+			t.Fatal("delayed frame rejected: ", status)
+		}
+	}
+	// 第一个帧使用突发令牌,之后每个帧等待 1/20 秒
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatal("not delayed: ", d)
+	}
+	if r.getDelayed() != 2 || r.getDropped() != 0 {
+		t.Fatal("delayed: ", r.getDelayed(), " dropped: ", r.getDropped())
+	}
+}
+
+func Test_RateLimitClose(t *testing.T) {
+	r := newRateLimiter(&RateLimit{MessagesPerSecond: 1, Action: RateLimitClose})
+	if ok, _ := r.allow(false, 100); !ok {
+		t.Fatal("first message rejected")
+	}
+	if ok, status := r.allow(false, 100); ok || status != CloseRateLimited {
+		t.Fatal("status: ", status)
+	}
+	if r.getDropped() != 0 {
+		t.Fatal("dropped: ", r.getDropped())
+	}
+}
+
+func Test_SessionRateLimitCloseFrame(t *testing.T) {
+	_, peer, closed := newPipeSession(t, &ConfigureSession{RateLimit: &RateLimit{ControlPerSecond: 1}})
+	writePeerFrame(t, peer, 0x01, 0x09, []byte("ping"))
+	if f := readPeerFrame(t, peer); f.Opcode != 0x0A {
+		t.Fatal("opcode: ", f.Opcode)
+	}
+	// 控制帧的令牌已用完,关闭帧仍然完成关闭握手
+	writePeerClose(t, peer, CloseNormalClosure)
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != CloseNormalClosure {
+		t.Fatal("close reply status: ", status)
+	}
+	if status := waitStatus(t, closed, time.Second); status != CloseNormalClosure {
+		t.Fatal("status: ", status)
+	}
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+/*
+ReadProtection              读取保护,防止慢速攻击(slow-loris)
+  - FirstFrameDeadline      读取到第一个完整帧的最后期限,为零值时不限制
+  - FrameReadTimeout        帧开始后(包括负载),每次读取的最长等待,配置了 MinReadRate 且为0时默认为10秒
+  - MinReadRate             帧头的最低读取速率(字节/秒),帧头开始超过1秒仍未读取完成且速率低于该值时断开,<1时不限制;
+    负载不受限制(只受 FrameReadTimeout 限制),以免断开正常的大帧慢速上传
+  - FirstFrameCallBack      读取到第一个完整帧,或者在此之前断开时的回调,只执行一次
+  - Transport 不支持 ReadDeadliner 时,期限到达后关闭 Transport
+*/
+type ReadProtection struct {
+	FirstFrameDeadline time.Time
+	FrameReadTimeout   time.Duration
+	MinReadRate        int64
+	FirstFrameCallBack func()
+}
+
+// errSlowRead     读取速率过低
+var errSlowRead = errors.New("read rate is too low")
+
+// protectedReader     带读取保护的reader,只在读取的goroutine中使用
+type protectedReader struct {
+	conn        Transport
+	deadline    *readDeadline
+	p           ReadProtection
+	inFrame     bool // 帧已开始
+	inPayload   bool // 帧头已读取完成,正在读取负载
+	frameStart  time.Time
+	headerBytes int64 // 帧开始后,帧头读取完成之前读取的字节数
+	firstDone   bool
+}
+
+// newProtectedReader     p为空时直接返回conn
+func newProtectedReader(conn Transport, p *ReadProtection) io.Reader {
+	if p == nil {
+		return conn
+	}
+	r := &protectedReader{conn: conn, deadline: newReadDeadline(conn), p: *p}
+	if r.p.MinReadRate > 0 && r.p.FrameReadTimeout <= 0 {
+		r.p.FrameReadTimeout = 10 * time.Second
+	}
+	return r
+}
+
+// start           开始读取,配置第一个帧的最后期限
+func (r *protectedReader) start() error {
+	return r.deadline.set(r.p.FirstFrameDeadline)
+}
+
+func (r *protectedReader) Read(b []byte) (int, error) {
+	n, err := r.conn.Read(b)
+	if n <= 0 || r.p.FrameReadTimeout <= 0 {
+		return n, err
+	}
+	now := time.Now()
+	if !r.inFrame {
+		r.inFrame = true
+		r.frameStart = now
+		r.headerBytes = 0
+	}
+	if r.p.MinReadRate > 0 && !r.inPayload {
+		r.headerBytes += int64(n)
+		elapsed := now.Sub(r.frameStart)
+		if elapsed > time.Second && float64(r.headerBytes)/elapsed.Seconds() < float64(r.p.MinReadRate) {
+			return n, errSlowRead
+		}
+	}
+	deadline := now.Add(r.p.FrameReadTimeout)
+	if !r.firstDone && !r.p.FirstFrameDeadline.IsZero() && r.p.FirstFrameDeadline.Before(deadline) {
+		deadline = r.p.FirstFrameDeadline
+	}
+	if dErr := r.deadline.set(deadline); dErr != nil && err == nil {
+		err = dErr
+	}
+	return n, err
+}
+
+// headerDone      帧头读取完成,负载不再计算读取速率
+func (r *protectedReader) headerDone() {
+	r.inPayload = true
+}
+
+// frameDone       一个完整帧读取完成,清除读取期限
+func (r *protectedReader) frameDone() {
+	r.inFrame = false
+	r.inPayload = false
+	if !r.firstDone {
+		r.firstDone = true
+		r.deadline.set(time.Time{})
+		r.doFirstFrameCallBack()
+	} else if r.p.FrameReadTimeout > 0 {
+		r.deadline.set(time.Time{})
+	}
+}
+
+// stop            断开时执行,未读取到第一个帧时执行回调
+func (r *protectedReader) stop() {
+	r.deadline.stop()
+	if !r.firstDone {
+		r.firstDone = true
+		r.doFirstFrameCallBack()
+	}
+}
+
+func (r *protectedReader) doFirstFrameCallBack() {
+	if r.p.FirstFrameCallBack != nil {
+		r.p.FirstFrameCallBack()
+	}
+}
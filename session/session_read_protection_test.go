@@ -0,0 +1,109 @@
+package session
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func Test_ReadProtectionFirstFrameDeadline(t *testing.T) {
+	released := make(chan struct{}, 2)
+	rp := &ReadProtection{
+		FirstFrameDeadline: time.Now().Add(200 * time.Millisecond),
+		FirstFrameCallBack: func() { released <- struct{}{} },
+	}
+	_, _, closed := newPipeSession(t, &ConfigureSession{ReadProtection: rp})
+	if status := waitStatus(t, closed, time.Second); status != CloseReadConnFailed {
+		t.Fatal("status: ", status)
+	}
+	// 未读取到第一个帧就断开时也执行回调,且只执行一次
+	time.Sleep(50 * time.Millisecond)
+	if len(released) != 1 {
+		t.Fatal("FirstFrameCallBack: ", len(released))
+	}
+
+	// 不支持 ReadDeadliner 的 Transport,期限到达后关闭
+	closed = make(chan Status, 1)
+	conn, _ := newTestPipe(t)
+	sess := NewTransportSession(struct{ io.ReadWriteCloser }{conn}, true, &ConfigureSession{
+		ReadProtection:     &ReadProtection{FirstFrameDeadline: time.Now().Add(200 * time.Millisecond)},
+		DisConnectCallBack: func(id int64, status Status, db *ConnectionDatabase) { closed <- status },
+	})
+	go sess.DoConnect()
+	if status := waitStatus(t, closed, time.Second); status != CloseReadConnFailed {
+		t.Fatal("status: ", status)
+	}
+}
+
+func Test_ReadProtectionFirstFrame(t *testing.T) {
+	released := make(chan struct{}, 2)
+	received := make(chan struct{}, 1)
+	rp := &ReadProtection{
+		FirstFrameDeadline: time.Now().Add(200 * time.Millisecond),
+		FirstFrameCallBack: func() { released <- struct{}{} },
+	}
+	sess, peer, _ := newPipeSession(t, &ConfigureSession{
+		ReadProtection:      rp,
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) { received <- struct{}{} },
+	})
+	writePeerFrame(t, peer, 0x01, 0x01, []byte("first"))
+	<-received
+	if len(released) != 1 {
+		t.Fatal("FirstFrameCallBack: ", len(released))
+	}
+	// 期限之前读取到第一个帧,之后不再受期限限制
+	time.Sleep(300 * time.Millisecond)
+	if status := sess.GetStatus().Status; status != Connected {
+		t.Fatal("status: ", status)
+	}
+	sess.DisConnect()
+	time.Sleep(50 * time.Millisecond)
+	if len(released) != 1 {
+		t.Fatal("FirstFrameCallBack: ", len(released))
+	}
+}
+
+func Test_ReadProtectionMinReadRate(t *testing.T) {
+	rp := &ReadProtection{MinReadRate: 100, FrameReadTimeout: time.Second}
+	received := make(chan []byte, 1)
+	_, peer, closed := newPipeSession(t, &ConfigureSession{
+		ReadProtection:      rp,
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) { received <- payload },
+	})
+	// 帧头很快读取完成,负载的慢速上传不受 MinReadRate 限制
+	payload := []byte("0123456789012345678901234567890123456789")
+	bs := testPeerFragmentBytes(t, 0x01, 0x02, payload)
+	header := len(bs) - len(payload)
+	peer.Write(bs[:header])
+	for i := header; i < len(bs); i += 10 {
+		time.Sleep(400 * time.Millisecond)
+		peer.Write(bs[i : i+10])
+	}
+	select {
+	case p := <-received:
+		if string(p) != string(payload) {
+			t.Fatal("payload: ", string(p))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow payload rejected")
+	}
+
+	// 帧头的慢速读取
+	bs = testPeerFragmentBytes(t, 0x01, 0x01, []byte("slow"))
+	go func() {
+		for i := range bs {
+			if _, err := peer.Write(bs[i : i+1]); err != nil {
+				return
+			}
+			time.Sleep(400 * time.Millisecond)
+		}
+	}()
+	if status := waitStatus(t, closed, 3*time.Second); status != CloseReadConnFailed {
+		t.Fatal("status: ", status)
+	}
+	select {
+	case <-received:
+		t.Fatal("slow header accepted")
+	default:
+	}
+}
@@ -16,4 +16,6 @@ const (
 	CloseHartTimeOut     = frame.ClosePolicyViolation   //  心跳超时
 	CloseWriteConnFailed = frame.CloseGoingAway         //  写入失败
 	CloseReadConnFailed  = frame.CloseGoingAway         // 读取失败
+	CloseRateLimited     = frame.ClosePolicyViolation   // 超过接收速率限制
+	CloseIdleTimeout     = frame.CloseIdleTimeout       // 空闲超时
 )
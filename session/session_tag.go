@@ -0,0 +1,57 @@
+package session
+
+// TagCallBackHandle     session标签变更后的回调,oldValue/newValue为空字符串表示不存在
+type TagCallBackHandle func(id int64, key, oldValue, newValue string)
+
+func (s *websocketSession) SetTag(key, value string) {
+	if key == "" {
+		return
+	}
+	if value == "" {
+		s.DelTag(key)
+		return
+	}
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+	old := s.tags[key]
+	if old == value {
+		return
+	}
+	if s.tags == nil {
+		s.tags = map[string]string{}
+	}
+	s.tags[key] = value
+	if s.tagCb != nil {
+		s.tagCb(s.GetId(), key, old, value)
+	}
+}
+
+func (s *websocketSession) DelTag(key string) {
+	s.tagMu.Lock()
+	defer s.tagMu.Unlock()
+	old, ok := s.tags[key]
+	if !ok {
+		return
+	}
+	delete(s.tags, key)
+	if s.tagCb != nil {
+		s.tagCb(s.GetId(), key, old, "")
+	}
+}
+
+func (s *websocketSession) GetTag(key string) (string, bool) {
+	s.tagMu.RLock()
+	defer s.tagMu.RUnlock()
+	value, ok := s.tags[key]
+	return value, ok
+}
+
+func (s *websocketSession) GetTags() map[string]string {
+	s.tagMu.RLock()
+	defer s.tagMu.RUnlock()
+	tags := make(map[string]string, len(s.tags))
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	return tags
+}
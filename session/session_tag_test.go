@@ -0,0 +1,35 @@
+package session
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_SessionTags(t *testing.T) {
+	var changes []string
+	sess, _, _ := newPipeSession(t, &ConfigureSession{
+		Tags: map[string]string{"user": "u1"},
+		TagCallBackHandle: func(id int64, key, oldValue, newValue string) {
+			changes = append(changes, fmt.Sprintf("%s:%s->%s", key, oldValue, newValue))
+		},
+	})
+	sess.SetTag("user", "u1")
+	sess.SetTag("user", "u2")
+	sess.SetTag("room", "r1")
+	sess.SetTag("room", "")
+	sess.DelTag("room")
+	sess.SetTag("", "ignored")
+	want := []string{"user:u1->u2", "room:->r1", "room:r1->"}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Fatal("changes: ", changes)
+	}
+	// GetTags 返回拷贝
+	tags := sess.GetTags()
+	tags["user"] = "changed"
+	if v, ok := sess.GetTag("user"); !ok || v != "u2" {
+		t.Fatal("tag: ", v, ok)
+	}
+	if len(sess.GetTags()) != 1 {
+		t.Fatal("tags: ", sess.GetTags())
+	}
+}
@@ -0,0 +1,82 @@
+package session
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+Transport                 session的传输层,可以是任意的双工字节流:net.Conn,net.Pipe,stdin/stdout,SSH channel,多路复用的流等
+  - 实现了 ReadDeadliner 时,读取保护使用 SetReadDeadline
+  - 未实现 ReadDeadliner 时,读取期限到达后关闭 Transport 以中断阻塞的读取,效果等同于读取超时后断开
+  - 实现了 LocalAddr() net.Addr,RemoteAddr() net.Addr 时(如 net.Conn),记录到握手信息中
+  - 实现了 syscall.Conn 时(如 *net.TCPConn),以 writev 写入 net.Buffers
+*/
+type Transport interface {
+	io.ReadWriteCloser
+}
+
+// ReadDeadliner      支持读取期限的 Transport
+type ReadDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// deadliner          支持读写期限的 Transport
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// addrTransport      可以返回地址的 Transport
+type addrTransport interface {
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// clearDeadline      清除握手时配置的读写期限,不支持时忽略
+func clearDeadline(t Transport) error {
+	if d, ok := t.(deadliner); ok {
+		return d.SetDeadline(time.Time{})
+	}
+	return nil
+}
+
+// readDeadline       读取期限,Transport 不支持 ReadDeadliner 时以定时关闭代替
+type readDeadline struct {
+	t     Transport
+	d     ReadDeadliner
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newReadDeadline(t Transport) *readDeadline {
+	d, _ := t.(ReadDeadliner)
+	return &readDeadline{t: t, d: d}
+}
+
+// set                配置读取期限,零值时清除
+func (r *readDeadline) set(deadline time.Time) error {
+	if r.d != nil {
+		return r.d.SetReadDeadline(deadline)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if !deadline.IsZero() {
+		r.timer = time.AfterFunc(time.Until(deadline), func() {
+			r.t.Close()
+		})
+	}
+	return nil
+}
+
+// stop               停止定时关闭
+func (r *readDeadline) stop() {
+	if r.d == nil {
+		r.set(time.Time{})
+	}
+}
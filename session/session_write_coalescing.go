@@ -0,0 +1,80 @@
+package session
+
+import (
+	"net"
+	"time"
+)
+
+// DefaultCoalesceBytes     写入合并默认的最大长度
+const DefaultCoalesceBytes = 64 << 10
+
+/*
+WriteCoalescing             写入合并(类似Nagle),在时间窗口内把排队的多个消息合并为一次写入(系统调用)
+  - Delay                   合并的时间窗口,从第一个排队的消息开始计时,<=0:不合并(默认),对延迟敏感的 Session 不应开启
+  - MaxBytes                合并的数据达到该长度时立即写入,<=0:DefaultCoalesceBytes
+  - 控制帧(ping,pong,close)不等待,与已合并的消息一起立即写入
+  - 小于 MaxBytes 的数据消息由 Write 复制后提交,不等待写入完成即返回;写入失败时 Session 断开,之后的 Write 返回错误
+  - 不小于 MaxBytes 的数据消息及 NextWriter 的分包,等待写入完成后返回
+*/
+type WriteCoalescing struct {
+	Delay    time.Duration
+	MaxBytes int
+}
+
+// maxBytes         返回合并的最大长度
+func (c WriteCoalescing) maxBytes() int {
+	if c.MaxBytes <= 0 {
+		return DefaultCoalesceBytes
+	}
+	return c.MaxBytes
+}
+
+func (s *websocketSession) SetWriteCoalescing(c WriteCoalescing) {
+	s.coalescing.Store(c)
+}
+
+func (s *websocketSession) GetWriteCoalescing() WriteCoalescing {
+	c, _ := s.coalescing.Load().(WriteCoalescing)
+	return c
+}
+
+// coalesce         从first开始合并排队的写入请求,超时,达到最大长度或遇到控制帧时一次写入,只在写入goroutine中执行
+func (s *websocketSession) coalesce(first writeRequest, c WriteCoalescing) {
+	maxBytes := c.maxBytes()
+	reqs := []writeRequest{first}
+	size := buffersLen(first.bufs)
+	timer := time.NewTimer(c.Delay)
+	defer timer.Stop()
+	flush := false
+	for !flush && size < maxBytes {
+		select {
+		case <-timer.C:
+			flush = true
+		case <-s.done:
+			flush = true
+		case req := <-s.writeChan:
+			reqs = append(reqs, req)
+			size += buffersLen(req.bufs)
+			flush = req.flush
+		}
+	}
+	var err error
+	select {
+	case <-s.done:
+		// 合并期间已断开,不再写入
+		err = errNotConnected
+	default:
+		bufs := make(net.Buffers, 0, 2*len(reqs))
+		for _, req := range reqs {
+			bufs = append(bufs, req.bufs...)
+		}
+		_, err = s.writeFrame(bufs)
+	}
+	for _, req := range reqs {
+		if err != nil {
+			req.result <- writeResult{err: err}
+		} else {
+			req.result <- writeResult{n: buffersLen(req.bufs)}
+		}
+	}
+}
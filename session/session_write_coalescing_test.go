@@ -0,0 +1,150 @@
+package session
+
+import (
+	"errors"
+	"github.com/qdmc/websocket_packet/frame"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingConn      记录每次写入的长度,fail为1时写入失败
+type countingConn struct {
+	net.Conn
+	writes chan int
+	fail   int32
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&c.fail) == 1 {
+		return 0, errors.New("write failed")
+	}
+	n, err := c.Conn.Write(p)
+	c.writes <- n
+	return n, err
+}
+
+// newCoalescingSession   以 countingConn 生成一个开启写入合并的session,对端在goroutine中读取帧
+func newCoalescingSession(t *testing.T, c WriteCoalescing) (WebsocketSessionInterface, *countingConn, chan *frame.Frame, chan Status) {
+	serverConn, peer := newTestPipe(t)
+	conn := &countingConn{Conn: serverConn, writes: make(chan int, 16)}
+	closed := make(chan Status, 1)
+	sess := NewTransportSession(conn, true, &ConfigureSession{
+		WriteCoalescing:    &c,
+		DisConnectCallBack: func(id int64, status Status, db *ConnectionDatabase) { closed <- status },
+	})
+	go sess.DoConnect()
+	frames := make(chan *frame.Frame, 16)
+	go func() {
+		for {
+			_, f, status := frame.ReadOnceFrame(peer)
+			if status != frame.CloseNormalClosure {
+				return
+			}
+			frames <- f
+		}
+	}()
+	return sess, conn, frames, closed
+}
+
+// waitWrite         等待一次写入,返回写入的长度
+func waitWrite(t *testing.T, conn *countingConn, timeout time.Duration) int {
+	select {
+	case n := <-conn.writes:
+		return n
+	case <-time.After(timeout):
+		t.Fatal("write timeout")
+	}
+	return 0
+}
+
+// expectFrames      对端按顺序收到的帧
+func expectFrames(t *testing.T, frames chan *frame.Frame, want ...string) {
+	for i, w := range want {
+		select {
+		case f := <-frames:
+			if string(f.PayloadData) != w {
+				t.Fatalf("frame %d: got %q, want %q", i, f.PayloadData, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("frame timeout: ", i)
+		}
+	}
+}
+
+func Test_CoalesceBatch(t *testing.T) {
+	sess, conn, frames, _ := newCoalescingSession(t, WriteCoalescing{Delay: 100 * time.Millisecond})
+	for _, msg := range []string{"m0", "m1", "m2", "m3", "m4"} {
+		if _, err := sess.Write(1, []byte(msg)); err != nil {
+			t.Fatal("writeErr: ", err.Error())
+		}
+	}
+	// 5个帧(2字节帧头+2字节负载)一次写入
+	if n := waitWrite(t, conn, time.Second); n != 20 {
+		t.Fatal("coalesced write: ", n)
+	}
+	expectFrames(t, frames, "m0", "m1", "m2", "m3", "m4")
+	select {
+	case n := <-conn.writes:
+		t.Fatal("extra write: ", n)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func Test_CoalesceMaxBytes(t *testing.T) {
+	sess, conn, frames, _ := newCoalescingSession(t, WriteCoalescing{Delay: time.Second, MaxBytes: 10})
+	start := time.Now()
+	for _, msg := range []string{"aaaa", "bbbb", "cccc"} {
+		if _, err := sess.Write(1, []byte(msg)); err != nil {
+			t.Fatal("writeErr: ", err.Error())
+		}
+	}
+	// 达到 MaxBytes 时不等待 Delay
+	if n := waitWrite(t, conn, 500*time.Millisecond); n != 12 {
+		t.Fatal("first write: ", n)
+	}
+	expectFrames(t, frames, "aaaa", "bbbb")
+	// 剩余的消息在 Delay 后写入
+	if n := waitWrite(t, conn, 2*time.Second); n != 6 || time.Since(start) < time.Second {
+		t.Fatal("second write: ", n, time.Since(start))
+	}
+	expectFrames(t, frames, "cccc")
+	// 不小于 MaxBytes 的消息等待写入完成
+	if _, err := sess.Write(1, []byte("0123456789")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	if n := waitWrite(t, conn, 500*time.Millisecond); n != 12 {
+		t.Fatal("large write: ", n)
+	}
+}
+
+func Test_CoalesceControlFrame(t *testing.T) {
+	sess, conn, frames, _ := newCoalescingSession(t, WriteCoalescing{Delay: time.Second})
+	if _, err := sess.Write(1, []byte("data")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	// 控制帧不等待,与已合并的消息一起写入
+	if _, err := sess.Write(9, []byte("ping")); err != nil {
+		t.Fatal("writeErr: ", err.Error())
+	}
+	if n := waitWrite(t, conn, 500*time.Millisecond); n != 12 {
+		t.Fatal("flushed write: ", n)
+	}
+	expectFrames(t, frames, "data", "ping")
+}
+
+func Test_CoalesceWriteFailed(t *testing.T) {
+	sess, conn, _, closed := newCoalescingSession(t, WriteCoalescing{Delay: 50 * time.Millisecond})
+	atomic.StoreInt32(&conn.fail, 1)
+	// 小消息不等待写入完成,写入失败后断开
+	if _, err := sess.Write(1, []byte("lost")); err != nil {
+		t.Fatal("async write: ", err.Error())
+	}
+	if status := waitStatus(t, closed, time.Second); status != CloseWriteConnFailed {
+		t.Fatal("status: ", status)
+	}
+	if _, err := sess.Write(1, []byte("late")); err == nil {
+		t.Fatal("write after failure should fail")
+	}
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// closeGracePeriod     主动发送关闭帧后,等待对端回复关闭帧的最长时间,超时后直接关闭链接
+const closeGracePeriod = time.Second
+
+// errNotConnected      session已断开
+var errNotConnected = errors.New("not connected")
+
+// writeRequest         写入请求,由写入goroutine顺序执行
+type writeRequest struct {
+	bufs   net.Buffers // 编码后的帧,帧头与负载分开,负载在写入完成之前不能修改
+	flush  bool        // 控制帧,不参与写入合并,立即写入
+	result chan writeResult
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+/*
+writeLoop              写入goroutine,在 NewSession 时启动,断开后退出
+  - 所有帧(包括ping,pong,close)都在这里顺序写入,不会交错
+  - 心跳在单独的goroutine中计时,写入阻塞(对端不读取)时也能检测到对端无响应
+*/
+func (s *websocketSession) writeLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case req := <-s.writeChan:
+			// 断开后不再写入,关闭帧总是在断开之前提交
+			select {
+			case <-s.done:
+				req.result <- writeResult{err: errNotConnected}
+				return
+			default:
+			}
+			if c := s.GetWriteCoalescing(); c.Delay > 0 && !req.flush {
+				s.coalesce(req, c)
+				continue
+			}
+			n, err := s.writeFrame(req.bufs)
+			req.result <- writeResult{n: n, err: err}
+		}
+	}
+}
+
+/*
+writeFrame       写入编码后的帧,只在写入goroutine中执行
+  - conn 支持 syscall.Conn(*net.TCPConn,*net.UnixConn)时以 writev 一次写入,不复制负载
+  - 其它 conn(如 tls.Conn)的 net.Buffers 会逐段写入,这里先合并为一段再写入
+*/
+func (s *websocketSession) writeFrame(bufs net.Buffers) (int, error) {
+	var n int
+	var err error
+	if len(bufs) == 1 {
+		n, err = s.conn.Write(bufs[0])
+	} else if _, ok := s.conn.(syscall.Conn); ok {
+		var n64 int64
+		n64, err = bufs.WriteTo(s.conn)
+		n = int(n64)
+	} else {
+		n, err = s.conn.Write(joinBuffers(bufs))
+	}
+	if err != nil {
+		if s.close(CloseWriteConnFailed) {
+			s.conn.Close()
+		}
+		return 0, err
+	}
+	atomic.AddUint64(s.writeLen, uint64(n))
+	s.touchIdle(true)
+	return n, nil
+}
+
+// submit           提交编码后的帧到写入goroutine,返回写入结果;flush为true时不参与写入合并
+func (s *websocketSession) submit(bufs net.Buffers, flush bool) (<-chan writeResult, error) {
+	req := writeRequest{bufs: bufs, flush: flush, result: make(chan writeResult, 1)}
+	select {
+	case <-s.done:
+		return nil, errNotConnected
+	case s.writeChan <- req:
+	}
+	return req.result, nil
+}
+
+// sendClose        提交关闭帧,并在 closeGracePeriod 后关闭链接;对端不读取(写入阻塞)时也不会一直等待
+func (s *websocketSession) sendClose(status Status) {
+	time.AfterFunc(closeGracePeriod, func() {
+		s.conn.Close()
+	})
+	s.enqueue(s.closeFrameBuffers(status), true)
+}
+
+// enqueue          提交编码后的帧到写入goroutine,并等待写入结果
+func (s *websocketSession) enqueue(bufs net.Buffers, flush bool) (int, error) {
+	result, err := s.submit(bufs, flush)
+	if err != nil {
+		return 0, err
+	}
+	res := <-result
+	return res.n, res.err
+}
+
+// buffersLen       返回 net.Buffers 的总长度
+func buffersLen(bufs net.Buffers) int {
+	n := 0
+	for _, bs := range bufs {
+		n += len(bs)
+	}
+	return n
+}
+
+// joinBuffers      把 net.Buffers 合并为一段
+func joinBuffers(bufs net.Buffers) []byte {
+	bs := make([]byte, 0, buffersLen(bufs))
+	for _, b := range bufs {
+		bs = append(bs, b...)
+	}
+	return bs
+}
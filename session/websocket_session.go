@@ -2,15 +2,17 @@
 Package session  websocket链接
   - websocket.Conn 链接管理:帧的读取与写入,状态及回调;并自动回复pong帧,及定时(默认25)发送ping帧
   - Status         状态定义
-  - Callbacks      回调定义:  ConnectedCallBackHandle DisConnectCallBackHandle FrameCallBackHandle
+  - Callbacks      回调定义:  ConnectedCallBackHandle DisConnectCallBackHandle FrameCallBackHandle PingCallBackHandle PongCallBackHandle
 */
 package session
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/qdmc/websocket_packet/frame"
+	"io"
 	"net"
 	"net/http"
 	"sync"
@@ -24,7 +26,7 @@ type ConnectedCallBackHandle func(id int64, req *http.Request)
 // DisConnectCallBackHandle    断开链接后的回调
 type DisConnectCallBackHandle func(id int64, status Status, db *ConnectionDatabase)
 
-// FrameCallBackHandle         帧读取后的回调
+// FrameCallBackHandle         帧读取后的回调,payload 归回调所有(不来自缓冲池),可以在回调返回后继续使用
 type FrameCallBackHandle func(id int64, t byte, payload []byte)
 
 // ConnectionDatabase     链接数据
@@ -36,6 +38,8 @@ type ConnectionDatabase struct {
 	ReadLength    uint64 // 接收的数据长度
 	Status        Status // 状态
 	IsStatistics  bool   // 是否开启流量统计,默认为false
+	RateDropped   uint64 // 超过接收速率限制而丢弃的消息数
+	RateDelayed   uint64 // 超过接收速率限制而延迟读取的次数
 }
 
 /*
@@ -44,19 +48,64 @@ WebsocketSessionInterface                            session通用接口
   - GetId() int64                                    返回sessionId:服务端的sessionId全局唯一,客户端sessionId为0;
   - GetIdString() string                             返回sessionId,以兼容bingo框架的websocket_client_id为string类型
   - GetStatus() Status                               返回session状态
+  - GetConn() net.Conn                               返回链接,Transport 不是 net.Conn 时返回nil
+  - GetTransport() Transport                         返回传输层
   - DoConnect(autoPingTicker ...int64)               执行conn的读取,autoPingTicker:自动发送pingFrame的ticker,>=10为有效值,默认是25秒
-  - Write(frameType byte, bs []byte, keys ...uint32) 写入消息:frameType(消息类型,1,2,9,10 为有效值)
+  - Write(frameType byte, bs []byte, keys ...uint32) 写入消息:frameType(消息类型,1,2,9,10 为有效值);没有掩码时不复制bs,返回之前不能修改bs
   - DisConnect()                                     主动关闭链接
+  - SetTag(key, value string)                        设置标签,value为空时删除标签
+  - DelTag(key string)                               删除标签
+  - GetTag(key string) (string, bool)                返回标签
+  - GetTags() map[string]string                      返回所有标签的拷贝
+  - GetHandshake() HandshakeInfo                     返回握手的只读快照
+  - Context() context.Context                        返回session的Context,断开后取消
+  - Set(key string, value interface{})               设置属性
+  - Get(key string) (interface{}, bool)              返回属性
+  - Del(key string)                                  删除属性
+  - SetMessageLimits(l MessageLimits)                配置接收消息的大小限制,立即生效(正在读取的帧仍使用原来的 MaxFrameSize)
+  - GetMessageLimits() MessageLimits                 返回接收消息的大小限制
+  - SetIdlePolicy(p IdlePolicy)                      配置空闲超时策略,立即生效
+  - GetIdlePolicy() IdlePolicy                       返回空闲超时策略
+  - GetHeartbeatStats() HeartbeatStats               返回心跳统计
+  - SetPingCallBack(back PingCallBackHandle)         配置收到ping帧后的回调,可以自定义回复的pong帧
+  - SetPongCallBack(back PongCallBackHandle)         配置收到pong帧后的回调
+  - SetPingPayloadHandle(f PingPayloadHandle)        配置心跳ping帧的负载
+  - NextWriter(opcode byte) (io.WriteCloser, error)  以流的方式发送一个分包消息,Close 时发送最后一个分包
+  - NextReader() (byte, io.Reader, error)            拉取模式下,返回下一个消息的opcode及读取器
+  - SetWriteCoalescing(c WriteCoalescing)            配置写入合并,立即生效
+  - GetWriteCoalescing() WriteCoalescing             返回写入合并的配置
 */
 type WebsocketSessionInterface interface {
 	GetId() int64
 	GetIdString() string
 	GetConn() net.Conn
+	GetTransport() Transport
 	IsServer() bool
 	GetStatus() ConnectionDatabase
 	DoConnect()
 	Write(frameType byte, bs []byte, keys ...uint32) (int, error)
 	DisConnect(status ...Status)
+	SetTag(key, value string)
+	DelTag(key string)
+	GetTag(key string) (string, bool)
+	GetTags() map[string]string
+	GetHandshake() HandshakeInfo
+	Context() context.Context
+	Set(key string, value interface{})
+	Get(key string) (interface{}, bool)
+	Del(key string)
+	SetMessageLimits(l MessageLimits)
+	GetMessageLimits() MessageLimits
+	SetIdlePolicy(p IdlePolicy)
+	GetIdlePolicy() IdlePolicy
+	GetHeartbeatStats() HeartbeatStats
+	SetPingCallBack(back PingCallBackHandle)
+	SetPongCallBack(back PongCallBackHandle)
+	SetPingPayloadHandle(f PingPayloadHandle)
+	NextWriter(opcode byte) (io.WriteCloser, error)
+	NextReader() (byte, io.Reader, error)
+	SetWriteCoalescing(c WriteCoalescing)
+	GetWriteCoalescing() WriteCoalescing
 }
 
 /*
@@ -67,6 +116,14 @@ NewSession                     生成一个 WebsocketSessionInterface
   - pintTicker   自动发送pingFrame的时间(秒)配置,
 */
 func NewSession(conn net.Conn, isServer bool, opt *ConfigureSession) WebsocketSessionInterface {
+	return NewTransportSession(conn, isServer, opt)
+}
+
+/*
+NewTransportSession            以任意的双工字节流生成一个 WebsocketSessionInterface,握手需要在之前完成
+  - conn 不是 net.Conn 时,GetConn 返回nil,依赖读取期限的功能见 Transport 的说明
+*/
+func NewTransportSession(conn Transport, isServer bool, opt *ConfigureSession) WebsocketSessionInterface {
 	id := int64(0)
 	if isServer {
 		id = getSessionId()
@@ -78,29 +135,96 @@ func NewSession(conn net.Conn, isServer bool, opt *ConfigureSession) WebsocketSe
 		mu:           sync.Mutex{},
 		conn:         conn,
 		status:       Connected,
-		stopChan:     make(chan struct{}, 1),
-		pingTime:     0,
-		pingTicker:   nil,
+		done:         make(chan struct{}),
+		writeChan:    make(chan writeRequest),
+		dataSem:      make(chan struct{}, 1),
+		nextChan:     make(chan *messageReader),
 		isStatistics: false,
 		startNano:    time.Now().UnixNano(),
 		readLen:      &rLen,
 		writeLen:     &wLen,
+		tags:         map[string]string{},
+		values:       map[string]interface{}{},
 	}
+	sess.ctx, sess.cancel = context.WithCancel(context.Background())
+	sess.messageLimits.Store(MessageLimits{})
+	sess.coalescing.Store(WriteCoalescing{})
+	sess.reader = conn
 	if opt != nil {
 		sess.isStatistics = opt.IsStatistics
 		sess.connectedCb = opt.ConnectedCallBackHandle
 		sess.disConnectCb = opt.DisConnectCallBack
 		sess.frameCb = opt.FrameCallBackHandle
-		if opt.AutoPingTicker >= 1 {
+		sess.tagCb = opt.TagCallBackHandle
+		if opt.Codec != nil {
+			sess.codecOptions = *opt.Codec
+		}
+		sess.streamCb = opt.StreamCallBackHandle
+		sess.pullMode = opt.PullMode
+		sess.control = controlHandles{
+			onPing:      opt.PingCallBackHandle,
+			onPong:      opt.PongCallBackHandle,
+			pingPayload: opt.PingPayloadHandle,
+		}
+		for key, value := range opt.Tags {
+			if key != "" && value != "" {
+				sess.tags[key] = value
+			}
+		}
+		for key, value := range opt.Values {
+			sess.values[key] = value
+		}
+		if opt.Handshake != nil {
+			sess.handshake = opt.Handshake.clone()
+		}
+		sess.rateLimiter = newRateLimiter(opt.RateLimit)
+		if opt.MessageLimits != nil {
+			sess.messageLimits.Store(*opt.MessageLimits)
+		}
+		if opt.WriteCoalescing != nil {
+			sess.coalescing.Store(*opt.WriteCoalescing)
+		}
+		sess.reader = newProtectedReader(conn, opt.ReadProtection)
+		if opt.IdlePolicy != nil {
+			sess.idle = *opt.IdlePolicy
+		}
+		if opt.Heartbeat != nil {
+			sess.heartbeat = newHeartbeat(*opt.Heartbeat)
+		} else if opt.AutoPingTicker >= 1 {
 			if opt.AutoPingTicker >= 120 {
 				opt.AutoPingTicker = 120
 			}
 			if opt.AutoPingTicker <= 25 {
 				opt.AutoPingTicker = 25
 			}
-			sess.pingTime = opt.AutoPingTicker
+			sess.heartbeat = newHeartbeat(Heartbeat{Interval: time.Duration(opt.AutoPingTicker) * time.Second})
+		}
+	}
+	if a, ok := conn.(addrTransport); ok {
+		if sess.handshake.RemoteAddr == "" && a.RemoteAddr() != nil {
+			sess.handshake.RemoteAddr = a.RemoteAddr().String()
+		}
+		if sess.handshake.LocalAddr == "" && a.LocalAddr() != nil {
+			sess.handshake.LocalAddr = a.LocalAddr().String()
 		}
 	}
+	if sess.codecOptions.Role == frame.RoleNone {
+		if isServer {
+			sess.codecOptions.Role = frame.RoleServer
+		} else {
+			sess.codecOptions.Role = frame.RoleClient
+		}
+	}
+	sess.codec = frame.NewCodecWithOptions(sess.codecOptions)
+	sess.frameReader = sess.codec.NewReader(sess.reader)
+	if sess.streamCb == nil && !sess.pullMode {
+		// 数据帧的负载交给 FrameCallBackHandle 后不再归还,按实际长度分配
+		sess.frameReader.SetDataPooled(false)
+	}
+	if pr, ok := sess.reader.(*protectedReader); ok {
+		sess.frameReader.SetHeaderHandle(pr.headerDone)
+	}
+	go sess.writeLoop()
 	return sess
 }
 
@@ -108,20 +232,52 @@ type websocketSession struct {
 	id                int64
 	isServer          bool
 	mu                sync.Mutex
-	conn              net.Conn
+	conn              Transport
 	status            Status
+	closing           Status // 本端已发送(或正在发送)的关闭帧的状态,0:未发送
 	connectedCb       ConnectedCallBackHandle
 	disConnectCb      DisConnectCallBackHandle
 	frameCb           FrameCallBackHandle
-	stopChan          chan struct{}
-	pingTime          int64
-	pingTicker        *time.Ticker
+	done              chan struct{}
+	writeChan         chan writeRequest
+	dataSem           chan struct{}
+	codecOptions      frame.CodecOptions
+	codec             frame.CodecInterface
+	streamCb          StreamCallBackHandle
+	pullMode          bool
+	nextChan          chan *messageReader
+	pullMu            sync.Mutex
+	lastReader        *messageReader
+	stream            *messageReader
+	streaming         bool
+	streamLen         uint64
+	heartbeat         *heartbeat
+	controlMu         sync.RWMutex
+	control           controlHandles
 	continuationFrame *frame.Frame
 	isStatistics      bool
 	startNano         int64
 	closeNano         int64
 	readLen           *uint64
 	writeLen          *uint64
+	tagMu             sync.RWMutex
+	tags              map[string]string
+	tagCb             TagCallBackHandle
+	handshake         HandshakeInfo
+	valueMu           sync.RWMutex
+	values            map[string]interface{}
+	ctx               context.Context
+	cancel            context.CancelFunc
+	rateLimiter       *rateLimiter
+	messageLimits     atomic.Value
+	coalescing        atomic.Value
+	fragments         int
+	reader            io.Reader
+	frameReader       *frame.Reader
+	idleMu            sync.Mutex
+	idle              IdlePolicy
+	idleTimer         *time.Timer
+	started           bool
 }
 
 func (s *websocketSession) GetIdString() string {
@@ -130,7 +286,14 @@ func (s *websocketSession) GetIdString() string {
 func (s *websocketSession) GetId() int64 {
 	return s.id
 }
+
+// GetConn      Transport 不是 net.Conn 时返回nil
 func (s *websocketSession) GetConn() net.Conn {
+	c, _ := s.conn.(net.Conn)
+	return c
+}
+
+func (s *websocketSession) GetTransport() Transport {
 	return s.conn
 }
 func (s *websocketSession) IsServer() bool {
@@ -138,219 +301,307 @@ func (s *websocketSession) IsServer() bool {
 }
 
 func (s *websocketSession) GetStatus() ConnectionDatabase {
+	s.mu.Lock()
+	status, closeNano := s.status, s.closeNano
+	s.mu.Unlock()
 	return ConnectionDatabase{
 		Id:            s.id,
 		ConnectedNano: s.startNano,
-		CloseNano:     s.closeNano,
+		CloseNano:     closeNano,
 		WriteLength:   atomic.LoadUint64(s.writeLen),
 		ReadLength:    atomic.LoadUint64(s.readLen),
-		Status:        s.status,
+		Status:        status,
 		IsStatistics:  s.isStatistics,
+		RateDropped:   s.rateLimiter.getDropped(),
+		RateDelayed:   s.rateLimiter.getDelayed(),
 	}
 }
 
-func (s *websocketSession) doPing() {
-	s.Write(9, []byte("Hello"))
+// getStatus      返回当前状态
+func (s *websocketSession) getStatus() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
 }
+
+/*
+DoConnect              执行conn的读取,直到断开
+  - 读取在当前goroutine中执行,写入在写入goroutine中执行,心跳在单独的goroutine中计时,互不阻塞
+  - 控制帧在读取中顺序处理,数据帧的回调在新的goroutine中执行
+*/
 func (s *websocketSession) DoConnect() {
-	if s.status != Connected {
-		return
+	pr, _ := s.reader.(*protectedReader)
+	if pr != nil {
+		defer pr.stop()
 	}
-	err := s.conn.SetDeadline(time.Time{})
-	if err != nil {
+	if s.getStatus() != Connected {
 		return
 	}
-	var status Status = CloseNormalClosure
+	status := CloseReadConnFailed
 	defer func() {
-		s.conn.Close()
+		// 本端检测到的协议错误或违反策略时,通知对端关闭原因;读取失败时不再写入
+		if status != CloseReadConnFailed && s.getStatus() == Connected {
+			if _, ok := s.startClosing(status); ok {
+				s.sendClose(status)
+			}
+		}
 		s.close(status)
+		s.conn.Close()
 	}()
-	if s.pingTime >= 1 {
-		s.pingTicker = time.NewTicker(time.Duration(s.pingTime) * time.Second)
-		for {
-			select {
-			case <-s.stopChan:
-				return
-			case <-s.pingTicker.C:
-				go s.doPing()
-				continue
-			default:
-				readLen, f, readStatus := frame.ReadOnceFrame(s.conn)
-				if readStatus != frame.CloseNormalClosure {
-					status = readStatus
-					return
-				} else {
-					// 流量统计
-					if s.isStatistics {
-						atomic.AddUint64(s.readLen, uint64(readLen))
-					}
-					// 处理分包合并,Fin为1时,表示最后一个分包
-					if f.Fin == 0 {
-						if s.continuationFrame == nil {
-							s.continuationFrame = f
-						} else {
-							s.continuationFrame.PayloadData = append(s.continuationFrame.PayloadData, f.PayloadData...)
-						}
-					} else {
-						// 这里合并分包,并弹出
-						if s.continuationFrame != nil {
-							composeFrame := new(frame.Frame)
-							composeFrame.SetOpcode(f.Opcode)
-							composeFrame.SetPayload(append(s.continuationFrame.PayloadData, f.PayloadData...))
-							s.continuationFrame = nil
-							go s.doFrameCallBack(composeFrame)
-						} else {
-							go s.doFrameCallBack(f)
-						}
-
-					}
-					continue
-				}
-			}
+	if err := clearDeadline(s.conn); err != nil {
+		return
+	}
+	if pr != nil {
+		if err := pr.start(); err != nil {
+			return
 		}
-	} else {
-		for {
-			select {
-			case <-s.stopChan:
-				return
-			default:
-				readLen, f, readStatus := frame.ReadOnceFrame(s.conn)
-				if readStatus != frame.CloseNormalClosure {
-					status = readStatus
-					return
-				} else {
-					// 流量统计
-					if s.isStatistics {
-						atomic.AddUint64(s.readLen, uint64(readLen))
-					}
-					// 处理分包合并,Fin为1时,表示最后一个分包
-					if f.Fin == 0 {
-						if s.continuationFrame == nil {
-							s.continuationFrame = f
-						} else {
-							s.continuationFrame.PayloadData = append(s.continuationFrame.PayloadData, f.PayloadData...)
-						}
-					} else {
-						// 这里合并分包,并弹出
-						if s.continuationFrame != nil {
-							composeFrame := new(frame.Frame)
-							composeFrame.SetOpcode(f.Opcode)
-							composeFrame.SetPayload(append(s.continuationFrame.PayloadData, f.PayloadData...))
-							s.continuationFrame = nil
-							go s.doFrameCallBack(composeFrame)
-						} else {
-							go s.doFrameCallBack(f)
-						}
+	}
+	s.idleMu.Lock()
+	s.started = true
+	s.idleMu.Unlock()
+	s.startIdle()
+	if s.heartbeat != nil {
+		go s.heartbeatLoop()
+	}
+	for {
+		var ok bool
+		if status, ok = s.readOnce(); !ok {
+			return
+		}
+	}
+}
 
-					}
-					continue
-				}
+// readOnce      读取并处理一个帧,返回false时断开
+func (s *websocketSession) readOnce() (Status, bool) {
+	limits := s.effectiveLimits()
+	readLen, f, readStatus := s.frameReader.ReadFrame(limits.MaxFrameSize)
+	if readStatus == frame.CloseNormalClosure {
+		readStatus = s.codec.Check(f)
+	}
+	if readStatus != frame.CloseNormalClosure {
+		return readStatus, false
+	}
+	// 等待帧期间可能调用了 SetMessageLimits,消息的限制以读取完成时为准
+	limits = s.effectiveLimits()
+	if pr, ok := s.reader.(*protectedReader); ok {
+		pr.frameDone()
+	}
+	s.touchIdle(false)
+	// 流量统计
+	if s.isStatistics {
+		atomic.AddUint64(s.readLen, uint64(readLen))
+	}
+	// 控制帧可以穿插在分包之间,不参与合并
+	if f.Opcode >= 8 {
+		// 关闭帧不参与速率限制,丢弃后关闭握手只能以超时结束
+		if f.Opcode != 8 {
+			if ok, status := s.rateLimiter.allow(true, len(f.PayloadData)); !ok {
+				return status, status == CloseNormalClosure // 丢弃消息时继续读取
 			}
 		}
+		defer f.Release()
+		return s.doControlFrame(f)
 	}
-
-}
-func (s *websocketSession) doFrameCallBack(f *frame.Frame) {
-	if f == nil {
-		return
+	if s.streamCb != nil || s.pullMode {
+		return s.readStream(f, limits)
+	}
+	// 数据帧开始新消息时不能有未完成的分包,延续帧必须有未完成的分包
+	if (f.Opcode == 0) != (s.continuationFrame != nil) {
+		return frame.CloseProtocolError, false
 	}
-	if f.Opcode == 8 {
+	if s.continuationFrame != nil {
+		s.fragments++
+		if limits.MaxFragments > 0 && s.fragments > limits.MaxFragments {
+			return frame.CloseMessageTooBig, false
+		}
+		if limits.MaxMessageSize > 0 && uint64(len(s.continuationFrame.PayloadData))+uint64(len(f.PayloadData)) > limits.MaxMessageSize {
+			return frame.CloseMessageTooBig, false
+		}
+	} else if limits.MaxMessageSize > 0 && uint64(len(f.PayloadData)) > limits.MaxMessageSize {
+		return frame.CloseMessageTooBig, false
+	}
+	// 处理分包合并,Fin为1时,表示最后一个分包
+	if f.Fin == 0 {
+		if s.continuationFrame == nil {
+			s.continuationFrame = f
+			s.fragments = 1
+		} else {
+			s.continuationFrame.PayloadData = append(s.continuationFrame.PayloadData, f.PayloadData...)
+			f.Release()
+		}
+		return CloseNormalClosure, true
+	}
+	// 这里合并分包,并弹出
+	if s.continuationFrame != nil {
+		composeFrame := new(frame.Frame)
+		composeFrame.SetOpcode(s.continuationFrame.Opcode)
+		composeFrame.SetPayload(append(s.continuationFrame.PayloadData, f.PayloadData...))
+		f.Release()
+		s.continuationFrame = nil
+		s.fragments = 0
+		f = composeFrame
+	}
+	if ok, status := s.rateLimiter.allow(false, len(f.PayloadData)); !ok {
+		return status, status == CloseNormalClosure // 丢弃消息时继续读取
+	}
+	if s.frameCb != nil {
+		go s.frameCb(s.GetId(), f.Opcode, f.PayloadData)
+	}
+	return CloseNormalClosure, true
+}
+
+// doControlFrame    处理控制帧,收到关闭帧时返回false
+func (s *websocketSession) doControlFrame(f *frame.Frame) (Status, bool) {
+	switch f.Opcode {
+	case 8:
 		status := CloseNormalClosure
-		if f.PayloadData != nil && len(f.PayloadData) > 2 {
+		if len(f.PayloadData) >= 2 {
 			status = Status(binary.BigEndian.Uint16(f.PayloadData[0:2]))
 		}
-		s.close(status)
-	} else if f.Opcode == 9 {
-		s.Write(10, f.PayloadData)
-	} else if f.Opcode == 10 {
-		return
-	} else {
-		if s.frameCb != nil {
-			go s.frameCb(s.GetId(), f.Opcode, f.PayloadData)
+		// 本端发起关闭时,这是对端的回复,以本端的关闭状态断开
+		sent, ok := s.startClosing(status)
+		if !ok {
+			return sent, false
 		}
+		// 对端发起关闭时回复关闭帧
+		if s.getStatus() == Connected {
+			s.sendClose(status)
+			s.close(status)
+		}
+		return status, false
+	case 9:
+		s.doPing(f.PayloadData)
+	case 10:
+		s.doPong(f.PayloadData)
 	}
+	return CloseNormalClosure, true
 }
+
 func (s *websocketSession) Write(frameType byte, bs []byte, keys ...uint32) (int, error) {
-	var frameBytes []byte
+	var bufs net.Buffers
 	var err error
-	var writeLen int
 	if s.isServer == true {
 		keys = nil
 	}
-	switch frameType {
-	case 1:
-		frameBytes, err = frame.AutoTextFramesBytes(bs, keys...)
-	case 2:
-		frameBytes, err = frame.AutoBinaryFramesBytes(bs, keys...)
-	case 9:
-		frameBytes, err = frame.NewPingFrame(bs, keys...).ToBytes()
-	case 10:
-		frameBytes, err = frame.NewPongFrame(bs, keys...).ToBytes()
-	default:
-		err = errors.New("frameType must be in 1,2,9,10")
+	if frameType != 1 && frameType != 2 && frameType != 9 && frameType != 10 {
+		return 0, errors.New("frameType must be in 1,2,9,10")
 	}
-	if err != nil {
-		return writeLen, err
-	}
-	if s.status == Connected {
-		writeLen, err = s.conn.Write(frameBytes)
-		if err != nil {
-			s.close(CloseWriteConnFailed)
-			return 0, err
+	if len(keys) == 1 {
+		// 指定了掩码key时,不分包
+		f := new(frame.Frame)
+		f.SetFin(0x01)
+		f.SetOpcode(frameType)
+		f.SetMaskingKey(keys[0])
+		f.SetPayload(bs)
+		if frameType >= 9 && len(bs) > 125 {
+			f.SetPayload(bs[0:125])
 		}
-		atomic.AddUint64(s.writeLen, uint64(writeLen))
-		return writeLen, nil
+		bufs, err = f.ToBuffers()
 	} else {
-		return writeLen, errors.New("not connected")
+		bufs, err = s.codec.EncodeMessageBuffers(frameType, bs)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if frameType >= 9 {
+		return s.enqueue(bufs, true)
+	}
+	// 写入合并时,小消息复制后提交,不等待写入完成
+	n := buffersLen(bufs)
+	c := s.GetWriteCoalescing()
+	async := c.Delay > 0 && n < c.maxBytes()
+	if async {
+		bufs = net.Buffers{joinBuffers(bufs)}
+	}
+	// 数据帧按顺序提交,不能穿插在 NextWriter 的分包之间;提交后即释放,以便写入合并
+	if err = s.lockData(); err != nil {
+		return 0, err
 	}
+	result, err := s.submit(bufs, false)
+	s.unlockData()
+	if err != nil {
+		return 0, err
+	}
+	if async {
+		return n, nil
+	}
+	res := <-result
+	return res.n, res.err
 }
 
 func (s *websocketSession) SetDisConnectCallBack(back DisConnectCallBackHandle) {
-	if s.status != Connected {
+	if s.getStatus() != Connected {
 		return
 	}
 	s.disConnectCb = back
 }
 
 func (s *websocketSession) SetFrameCallBack(back FrameCallBackHandle) {
-	if s.status != Connected {
+	if s.getStatus() != Connected {
 		return
 	}
 	s.frameCb = back
 }
 
+/*
+DisConnect             主动关闭链接
+  - 发送关闭帧后立即变更状态,并等待对端回复关闭帧,超过 closeGracePeriod 后直接关闭链接
+*/
 func (s *websocketSession) DisConnect(status ...Status) {
-	if s.status == Connected {
-		bs, _ := frame.NewCloseFrame(status...).ToBytes()
-		s.conn.Write(bs)
-		if status != nil && len(status) == 1 {
-			s.close(status[0])
-		} else {
-			s.close(CloseNormalClosure)
-		}
-
+	closeStatus := CloseNormalClosure
+	if status != nil && len(status) == 1 {
+		closeStatus = status[0]
+	}
+	if s.getStatus() != Connected {
+		return
+	}
+	if _, ok := s.startClosing(closeStatus); !ok {
+		return
 	}
+	s.sendClose(closeStatus)
+	s.close(closeStatus)
+}
 
+// startClosing   标记本端发送关闭帧,只有第一次调用返回true;返回已标记的关闭状态
+func (s *websocketSession) startClosing(status Status) (Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing != 0 {
+		return s.closing, false
+	}
+	s.closing = status
+	return status, true
 }
-func (s *websocketSession) close(status Status) {
+
+// close          变更为断开状态,并执行断开回调;只有第一次调用返回true;已发送关闭帧时,以关闭帧的状态断开(之后的读写失败不影响状态)
+func (s *websocketSession) close(status Status) bool {
 	s.mu.Lock()
+	if s.status != Connected {
+		s.mu.Unlock()
+		return false
+	}
+	if s.closing != 0 {
+		status = s.closing
+	}
+	s.closeNano = time.Now().UnixNano()
+	s.status = status
+	close(s.done)
 	s.mu.Unlock()
-	if s.status == Connected {
-		s.closeNano = time.Now().UnixNano()
-		if status == CloseNormalClosure || status == CloseReadConnFailed || CloseHartTimeOut == status {
-			close(s.stopChan)
-		}
-		s.status = status
-		if s.disConnectCb != nil {
-			if s.isStatistics {
-				db := s.GetStatus()
-				go s.disConnectCb(s.GetId(), s.status, &db)
-			} else {
-				go s.disConnectCb(s.GetId(), s.status, nil)
-			}
+	s.cancel()
+	s.stopIdle()
+	if s.disConnectCb != nil {
+		if s.isStatistics {
+			db := s.GetStatus()
+			go s.disConnectCb(s.GetId(), status, &db)
+		} else {
+			go s.disConnectCb(s.GetId(), status, nil)
 		}
 	}
-	if s.pingTicker != nil {
-		s.pingTicker.Stop()
-	}
+	return true
+}
+
+// closeFrameBuffers  生成关闭帧
+func (s *websocketSession) closeFrameBuffers(status Status) net.Buffers {
+	bufs, _ := s.codec.EncodeFrameBuffers(frame.NewCloseFrame(status))
+	return bufs
 }
@@ -0,0 +1,269 @@
+package session
+
+import (
+	"encoding/binary"
+	"github.com/qdmc/websocket_packet/frame"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPeerKey      测试对端(客户端)帧的掩码
+const testPeerKey = 0x11223344
+
+// newPipeSession   以 net.Pipe 生成一个服务端session并开始读取,返回对端的conn及断开状态的通道
+func newPipeSession(t *testing.T, opt *ConfigureSession) (WebsocketSessionInterface, net.Conn, chan Status) {
+	if opt == nil {
+		opt = &ConfigureSession{}
+	}
+	closed := make(chan Status, 1)
+	cb := opt.DisConnectCallBack
+	opt.DisConnectCallBack = func(id int64, status Status, db *ConnectionDatabase) {
+		if cb != nil {
+			cb(id, status, db)
+		}
+		closed <- status
+	}
+	serverConn, peer := newTestPipe(t)
+	sess := NewSession(serverConn, true, opt)
+	go sess.DoConnect()
+	return sess, peer, closed
+}
+
+// newTestPipe      生成一对 net.Pipe,测试结束时关闭
+func newTestPipe(t *testing.T) (net.Conn, net.Conn) {
+	serverConn, peer := net.Pipe()
+	t.Cleanup(func() {
+		peer.Close()
+		serverConn.Close()
+	})
+	return serverConn, peer
+}
+
+// testPeerFragmentBytes  生成对端(客户端)的一个带掩码的帧
+func testPeerFragmentBytes(t testing.TB, fin, opcode byte, payload []byte) []byte {
+	f := new(frame.Frame)
+	f.SetFin(fin)
+	f.SetOpcode(opcode)
+	f.SetMaskingKey(testPeerKey)
+	f.SetPayload(append([]byte(nil), payload...))
+	bs, err := f.ToBytes()
+	if err != nil {
+		t.Fatal("toBytesErr: ", err.Error())
+	}
+	return bs
+}
+
+// writePeerFrame   对端写入一个带掩码的帧
+func writePeerFrame(t *testing.T, peer net.Conn, fin, opcode byte, payload []byte) {
+	peer.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if _, err := peer.Write(testPeerFragmentBytes(t, fin, opcode, payload)); err != nil {
+		t.Fatal("peerWriteErr: ", err.Error())
+	}
+}
+
+// writePeerClose   对端写入一个关闭帧
+func writePeerClose(t *testing.T, peer net.Conn, status Status) {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(status))
+	writePeerFrame(t, peer, 0x01, 0x08, payload)
+}
+
+// readPeerFrame    对端读取一个帧,跳过opcode在skip中的帧
+func readPeerFrame(t *testing.T, peer net.Conn, skip ...byte) *frame.Frame {
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, f, status := frame.ReadOnceFrame(peer)
+		if status != frame.CloseNormalClosure {
+			t.Fatal("peerReadErr: ", status)
+		}
+		skipped := false
+		for _, op := range skip {
+			skipped = skipped || f.Opcode == op
+		}
+		if !skipped {
+			return f
+		}
+	}
+}
+
+// closeFrameStatus 返回关闭帧的状态
+func closeFrameStatus(t *testing.T, f *frame.Frame) Status {
+	if f.Opcode != 0x08 || len(f.PayloadData) < 2 {
+		t.Fatalf("not a close frame: opcode=%d payload=%v", f.Opcode, f.PayloadData)
+	}
+	return Status(binary.BigEndian.Uint16(f.PayloadData[0:2]))
+}
+
+// waitStatus       等待session断开,返回断开状态
+func waitStatus(t *testing.T, closed chan Status, timeout time.Duration) Status {
+	select {
+	case status := <-closed:
+		return status
+	case <-time.After(timeout):
+		t.Fatal("session not closed")
+	}
+	return 0
+}
+
+func Test_SessionCloseFromServer(t *testing.T) {
+	sess, peer, closed := newPipeSession(t, nil)
+	go sess.DisConnect()
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != CloseNormalClosure {
+		t.Fatal("close frame status: ", status)
+	}
+	writePeerClose(t, peer, CloseNormalClosure)
+	if status := waitStatus(t, closed, time.Second); status != CloseNormalClosure {
+		t.Fatal("status: ", status)
+	}
+	// 收到对端的回复后立即关闭链接,不等待 closeGracePeriod
+	peer.SetReadDeadline(time.Now().Add(closeGracePeriod / 2))
+	if _, err := peer.Read(make([]byte, 1)); err == nil || isTimeout(err) {
+		t.Fatal("transport not closed: ", err)
+	}
+}
+
+func Test_SessionCloseFromPeer(t *testing.T) {
+	_, peer, closed := newPipeSession(t, nil)
+	writePeerClose(t, peer, CloseNormalClosure)
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != CloseNormalClosure {
+		t.Fatal("close reply status: ", status)
+	}
+	if status := waitStatus(t, closed, time.Second); status != CloseNormalClosure {
+		t.Fatal("status: ", status)
+	}
+}
+
+func Test_SessionPingSilentPeer(t *testing.T) {
+	// 对端读取ping但不回复pong
+	_, peer, closed := newPipeSession(t, &ConfigureSession{Heartbeat: &Heartbeat{Interval: 50 * time.Millisecond, MaxMissed: 2}})
+	pings := 0
+	for {
+		f := readPeerFrame(t, peer)
+		if f.Opcode == 0x09 {
+			pings++
+			continue
+		}
+		if status := closeFrameStatus(t, f); status != CloseHartTimeOut {
+			t.Fatal("close frame status: ", status)
+		}
+		break
+	}
+	if pings != 2 {
+		t.Fatal("pings: ", pings)
+	}
+	if status := waitStatus(t, closed, time.Second); status != CloseHartTimeOut {
+		t.Fatal("status: ", status)
+	}
+
+	// 对端不读取,写入一直阻塞
+	_, _, closed = newPipeSession(t, &ConfigureSession{Heartbeat: &Heartbeat{Interval: 50 * time.Millisecond, MaxMissed: 2}})
+	if status := waitStatus(t, closed, 3*time.Second); status != CloseHartTimeOut {
+		t.Fatal("status: ", status)
+	}
+}
+
+func Test_SessionDisConnectNotReading(t *testing.T) {
+	sess, _, closed := newPipeSession(t, nil)
+	// 对端不读取时,关闭帧的写入阻塞,closeGracePeriod 后关闭链接
+	done := make(chan struct{})
+	go func() {
+		sess.DisConnect()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeGracePeriod + time.Second):
+		t.Fatal("DisConnect blocked")
+	}
+	if status := waitStatus(t, closed, time.Second); status != CloseNormalClosure {
+		t.Fatal("status: ", status)
+	}
+	if _, err := sess.Write(1, []byte("late")); err == nil {
+		t.Fatal("write after DisConnect should fail")
+	}
+}
+
+func Test_SessionCloseStatus(t *testing.T) {
+	// 对端的关闭状态原样回复,并作为断开状态
+	_, peer, closed := newPipeSession(t, nil)
+	writePeerClose(t, peer, 4001)
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != 4001 {
+		t.Fatal("close reply status: ", status)
+	}
+	if status := waitStatus(t, closed, time.Second); status != 4001 {
+		t.Fatal("status: ", status)
+	}
+
+	// 本端指定的关闭状态发送给对端,对端回复其它状态时仍以本端的状态断开
+	sess, peer, closed := newPipeSession(t, nil)
+	go sess.DisConnect(CloseIdleTimeout)
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != CloseIdleTimeout {
+		t.Fatal("close frame status: ", status)
+	}
+	writePeerClose(t, peer, CloseNormalClosure)
+	if status := waitStatus(t, closed, time.Second); status != CloseIdleTimeout {
+		t.Fatal("status: ", status)
+	}
+
+	// 本端检测到协议错误时,把错误状态发送给对端
+	_, peer, closed = newPipeSession(t, nil)
+	writePeerFrame(t, peer, 0x01, 0x00, []byte("orphan continuation"))
+	if status := closeFrameStatus(t, readPeerFrame(t, peer)); status != frame.CloseProtocolError {
+		t.Fatal("close frame status: ", status)
+	}
+	if status := waitStatus(t, closed, time.Second); status != frame.CloseProtocolError {
+		t.Fatal("status: ", status)
+	}
+}
+
+// isTimeout        是否是读写超时
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// benchTransport   循环读取同一个帧,读取n字节后返回 io.EOF;写入被丢弃
+type benchTransport struct {
+	frame []byte
+	pos   int
+	n     int
+}
+
+func (b *benchTransport) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		return 0, io.EOF
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n := copy(p, b.frame[b.pos:])
+	b.pos = (b.pos + n) % len(b.frame)
+	b.n -= n
+	return n, nil
+}
+
+func (b *benchTransport) Write(p []byte) (int, error) { return len(p), nil }
+
+func (b *benchTransport) Close() error { return nil }
+
+// benchmarkSessionRead   session读取数据帧并交给 FrameCallBackHandle 的完整路径
+func benchmarkSessionRead(b *testing.B, size int) {
+	bs := testPeerFragmentBytes(b, 0x01, 0x02, make([]byte, size))
+	var wg sync.WaitGroup
+	wg.Add(b.N)
+	sess := NewTransportSession(&benchTransport{frame: bs, n: b.N * len(bs)}, true, &ConfigureSession{
+		FrameCallBackHandle: func(id int64, t byte, payload []byte) { wg.Done() },
+	})
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	sess.DoConnect()
+	wg.Wait()
+}
+
+func BenchmarkSessionRead_128(b *testing.B) { benchmarkSessionRead(b, 128) }
+func BenchmarkSessionRead_33K(b *testing.B) { benchmarkSessionRead(b, 33<<10) }
+func BenchmarkSessionRead_64K(b *testing.B) { benchmarkSessionRead(b, 64<<10) }
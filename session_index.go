@@ -0,0 +1,121 @@
+package websocket_packet
+
+import (
+	"sort"
+	"sync"
+)
+
+// tagIndex      session标签的二级索引:key -> value -> sessionId
+type tagIndex struct {
+	mu          sync.RWMutex
+	index       map[string]map[string]map[int64]struct{}
+	sessionTags map[int64]map[string]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		index:       map[string]map[string]map[int64]struct{}{},
+		sessionTags: map[int64]map[string]string{},
+	}
+}
+
+// register       session加入管理器时,登记初始标签
+func (x *tagIndex) register(id int64, tags map[string]string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.sessionTags[id] = map[string]string{}
+	for key, value := range tags {
+		x.set(id, key, value)
+	}
+}
+
+// unregister     session移除时,清除所有标签
+func (x *tagIndex) unregister(id int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key := range x.sessionTags[id] {
+		x.del(id, key)
+	}
+	delete(x.sessionTags, id)
+}
+
+// onTagChange    session标签变更的回调,未登记的session忽略
+func (x *tagIndex) onTagChange(id int64, key, oldValue, newValue string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.sessionTags[id]; !ok {
+		return
+	}
+	if oldValue != "" {
+		x.del(id, key)
+	}
+	if newValue != "" {
+		x.set(id, key, newValue)
+	}
+}
+
+// set       需在锁内执行
+func (x *tagIndex) set(id int64, key, value string) {
+	if key == "" || value == "" {
+		return
+	}
+	tags := x.sessionTags[id]
+	if _, ok := tags[key]; ok {
+		x.del(id, key)
+	}
+	tags[key] = value
+	values, ok := x.index[key]
+	if !ok {
+		values = map[string]map[int64]struct{}{}
+		x.index[key] = values
+	}
+	ids, ok := values[value]
+	if !ok {
+		ids = map[int64]struct{}{}
+		values[value] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+// del       需在锁内执行
+func (x *tagIndex) del(id int64, key string) {
+	tags := x.sessionTags[id]
+	value, ok := tags[key]
+	if !ok {
+		return
+	}
+	delete(tags, key)
+	values := x.index[key]
+	ids := values[value]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(values, value)
+	}
+	if len(values) == 0 {
+		delete(x.index, key)
+	}
+}
+
+// find      返回标签匹配的sessionId列表
+func (x *tagIndex) find(key, value string) []int64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var ids itemKeys
+	for id := range x.index[key][value] {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	return ids
+}
+
+// values    返回某个标签的所有值
+func (x *tagIndex) values(key string) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var list []string
+	for value := range x.index[key] {
+		list = append(list, value)
+	}
+	sort.Strings(list)
+	return list
+}
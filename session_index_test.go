@@ -0,0 +1,125 @@
+package websocket_packet
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+// sortedIds      返回排序后的拷贝,便于比较
+func sortedIds(ids []int64) []int64 {
+	list := append([]int64(nil), ids...)
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// expectIds      比较sessionId列表(不计顺序)
+func expectIds(t *testing.T, name string, got []int64, want ...int64) {
+	got, want = sortedIds(got), sortedIds(want)
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+// expectValues   比较标签值列表
+func expectValues(t *testing.T, name string, got []string, want ...string) {
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", name, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func Test_TagIndex(t *testing.T) {
+	x := newTagIndex()
+	x.register(1, map[string]string{"user": "u1", "room": "r1", "": "empty key", "empty": ""})
+	x.register(2, map[string]string{"user": "u1"})
+	expectIds(t, "register", x.find("user", "u1"), 1, 2)
+	expectValues(t, "register values", x.values("user"), "u1")
+	expectValues(t, "empty value", x.values("empty"))
+	// 修改标签
+	x.onTagChange(1, "user", "u1", "u2")
+	expectIds(t, "retag old", x.find("user", "u1"), 2)
+	expectIds(t, "retag new", x.find("user", "u2"), 1)
+	expectValues(t, "retag values", x.values("user"), "u1", "u2")
+	// 删除标签
+	x.onTagChange(1, "room", "r1", "")
+	expectIds(t, "delete", x.find("room", "r1"))
+	if _, ok := x.index["room"]; ok {
+		t.Fatal("empty key not removed")
+	}
+	// 添加标签
+	x.onTagChange(2, "room", "", "r2")
+	expectIds(t, "add", x.find("room", "r2"), 2)
+	x.unregister(1)
+	expectIds(t, "unregister", x.find("user", "u2"))
+	expectValues(t, "unregister values", x.values("user"), "u1")
+	// 移除后(或登记前)的标签变更被忽略
+	x.onTagChange(1, "user", "u2", "u3")
+	x.onTagChange(3, "user", "", "u3")
+	expectIds(t, "late change", x.find("user", "u3"))
+	x.unregister(2)
+	if len(x.index) != 0 || len(x.sessionTags) != 0 {
+		t.Fatal("index not empty: ", x.index, x.sessionTags)
+	}
+}
+
+func Test_ManagerFindByTag(t *testing.T) {
+	server, ts, ids := newTestServer(t, nil)
+	server.SetHandshakeHandle(func(req *http.Request, resp *HandshakeResponse) HandshakeDecision {
+		SetHandshakeTag(req, "user", req.Header.Get("X-User"))
+		return AcceptHandshake()
+	})
+	c1, _ := testDialSession(t, ts, http.Header{"X-User": {"u1"}})
+	id1 := waitTestId(t, ids)
+	testDialSession(t, ts, http.Header{"X-User": {"u1"}})
+	id2 := waitTestId(t, ids)
+	testDialSession(t, ts, http.Header{"X-User": {"u2"}})
+	id3 := waitTestId(t, ids)
+
+	expectIds(t, "handshake tags", server.FindIdsByTag("user", "u1"), id1, id2)
+	expectValues(t, "tag values", server.TagValues("user"), "u1", "u2")
+	var found []int64
+	for _, sess := range server.FindByTag("user", "u2") {
+		found = append(found, sess.GetId())
+	}
+	expectIds(t, "FindByTag", found, id3)
+
+	// 在session上修改标签
+	sess3, err := server.GetSessionOnce(id3)
+	if err != nil {
+		t.Fatal("getSessionErr: ", err.Error())
+	}
+	sess3.SetTag("user", "u1")
+	sess3.SetTag("room", "r1")
+	expectIds(t, "retag", server.FindIdsByTag("user", "u1"), id1, id2, id3)
+	expectValues(t, "retag values", server.TagValues("user"), "u1")
+	sess3.DelTag("room")
+	expectValues(t, "delete tag", server.TagValues("room"))
+
+	// 断开后从索引中移除,之后的 SetTag 不再进入索引
+	sess1, err := server.GetSessionOnce(id1)
+	if err != nil {
+		t.Fatal("getSessionErr: ", err.Error())
+	}
+	c1.DisConnect()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.FindIdsByTag("user", "u1")) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("closed session still indexed: ", server.FindIdsByTag("user", "u1"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sess1.SetTag("user", "late")
+	expectIds(t, "late SetTag", server.FindIdsByTag("user", "late"))
+	expectIds(t, "after disconnect", server.FindIdsByTag("user", "u1"), id2, id3)
+}
@@ -0,0 +1,103 @@
+package websocket_packet
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/qdmc/websocket_packet/session"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+UpgradeOptions             Upgrade 的配置
+  - Subprotocols           服务端支持的子协议,按优先级排序
+  - OriginPolicy           Origin 校验策略,为空时使用默认的同源策略
+  - HandshakeHandle        握手校验,在协议与 Origin 校验之后,Hijack 之前执行;可以通过 resp.Header() 配置回复的响应头;用 SetHandshakeValue,SetHandshakeTag,SetHandshakeIdlePolicy 设置的值合并到 Session 的配置中(优先于 Session 中的配置)
+  - Header                 101回复中附加的响应头
+  - Session                Session 的配置(回调,心跳,限制,编解码器等),为空时使用默认配置;Handshake 为空时使用本次握手的信息
+*/
+type UpgradeOptions struct {
+	Subprotocols    []string
+	OriginPolicy    *OriginPolicy
+	HandshakeHandle HandshakeHandle
+	Header          http.Header
+	Session         *session.ConfigureSession
+}
+
+/*
+Upgrade                    在任意的 http.Handler 中把请求升级为websocket链接,不经过 ServerHandlerInterface
+  - 执行协议校验,Origin 校验,HandshakeHandle,Hijack 并回复101
+  - 失败时已回复错误(Hijack 失败时除外),返回 HandshakeError
+  - 返回的 Session 由调用方管理:不会注册到 ServerHandlerInterface,需要调用方执行 DoConnect(一般在新的goroutine中)
+*/
+func Upgrade(w http.ResponseWriter, req *http.Request, opt UpgradeOptions) (Session, error) {
+	req, hv := withHandshakeValues(req)
+	resp := newHandshakeResponse()
+	for key, values := range opt.Header {
+		for _, value := range values {
+			resp.header.Add(key, value)
+		}
+	}
+	conn, err := serverUpgradeHandler(req, w, func(r *http.Request) error {
+		if !opt.OriginPolicy.Check(r) {
+			return &HandshakeError{Status: http.StatusForbidden, Body: "origin not allowed", Reason: HandshakeReasonOrigin}
+		}
+		if opt.HandshakeHandle != nil {
+			return decisionToError(opt.HandshakeHandle(r, resp), resp)
+		}
+		return nil
+	})
+	if err != nil {
+		writeHandshakeError(w, err)
+		return nil, err
+	}
+	subprotocol := negotiateSubprotocol(req, opt.Subprotocols, resp)
+	if err = writeUpgradeResponse(conn, makeServerHandshakeBytes(req, subprotocol, resp.header)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conf := session.ConfigureSession{}
+	if opt.Session != nil {
+		conf = *opt.Session
+	}
+	hv.apply(&conf)
+	if conf.Handshake == nil {
+		conf.Handshake = session.NewHandshakeInfo(req, subprotocol)
+		if ip := remoteIP(req); ip != nil {
+			conf.Handshake.ClientIP = ip.String()
+		}
+	}
+	return session.NewSession(conn, true, &conf), nil
+}
+
+// writeUpgradeResponse     回复101,并清除读写期限
+func writeUpgradeResponse(conn net.Conn, bs []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(bs); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// bufferedConn             Hijack 时 http.Server 已缓冲但未读取的数据,在conn之前读取
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// withBuffered             br中有已缓冲的数据时,返回先读取这些数据的conn
+func withBuffered(conn net.Conn, br *bufio.Reader) net.Conn {
+	if br == nil || br.Buffered() == 0 {
+		return conn
+	}
+	bs, _ := br.Peek(br.Buffered())
+	return &bufferedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(append([]byte(nil), bs...)), conn)}
+}
@@ -0,0 +1,148 @@
+package websocket_packet
+
+import (
+	"github.com/qdmc/websocket_packet/session"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Upgrade(t *testing.T) {
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var sess Session
+		sess, err := Upgrade(w, req, UpgradeOptions{
+			Subprotocols: []string{"chat"},
+			HandshakeHandle: func(r *http.Request, resp *HandshakeResponse) HandshakeDecision {
+				if r.Header.Get("token") != "ok" {
+					return RejectHandshake(http.StatusUnauthorized, "bad token")
+				}
+				return AcceptHandshake()
+			},
+			Session: &session.ConfigureSession{
+				FrameCallBackHandle: func(id int64, t byte, bs []byte) {
+					sess.Write(t, bs)
+				},
+			},
+		})
+		if err != nil {
+			return
+		}
+		if sess.GetHandshake().Subprotocol != "chat" {
+			t.Error("subprotocol: ", sess.GetHandshake().Subprotocol)
+		}
+		sess.DoConnect()
+	}))
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	bad := NewClient(NewClientOption().SetReConnect(-1, 1))
+	if err := bad.Dial(url); err == nil {
+		t.Fatal("dial without token should fail")
+	}
+
+	opt := NewClientOption().SetReConnect(-1, 1)
+	opt.RequestHeader.Set("token", "ok")
+	opt.RequestHeader.Set("Sec-WebSocket-Protocol", "chat")
+	opt.MessageCallback = func(t byte, bs []byte) {
+		received <- string(bs)
+	}
+	c := NewClient(opt)
+	if err := c.Dial(url); err != nil {
+		t.Fatal("dialErr: ", err.Error())
+	}
+	defer c.Disconnect()
+	if _, err := c.SendMessage(1, []byte("hello")); err != nil {
+		t.Fatal("sendErr: ", err.Error())
+	}
+	select {
+	case msg := <-received:
+		if msg != "hello" {
+			t.Fatal("echo: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("echo timeout")
+	}
+}
+
+func Test_NegotiateSubprotocol(t *testing.T) {
+	cases := []struct {
+		offered  string
+		server   []string
+		override string
+		want     string
+	}{
+		{"chat, json", []string{"json", "chat"}, "", "json"},
+		{"chat", []string{"json"}, "", ""},
+		{"chat, json", []string{"chat"}, "json", "json"},
+		// 客户端没有提供的子协议不能覆盖
+		{"chat", []string{"chat"}, "mqtt", "chat"},
+		{"", []string{"chat"}, "chat", ""},
+		{"chat", nil, "chat", "chat"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if c.offered != "" {
+			req.Header.Set("Sec-WebSocket-Protocol", c.offered)
+		}
+		resp := newHandshakeResponse()
+		if c.override != "" {
+			resp.Header().Set("Sec-WebSocket-Protocol", c.override)
+		}
+		if got := negotiateSubprotocol(req, c.server, resp); got != c.want {
+			t.Fatalf("offered=%q server=%v override=%q: got %q, want %q", c.offered, c.server, c.override, got, c.want)
+		}
+	}
+}
+
+func Test_UpgradeHandshakeValues(t *testing.T) {
+	conf := &session.ConfigureSession{
+		Tags:       map[string]string{"room": "r1", "user": "default"},
+		Values:     map[string]interface{}{"role": "guest"},
+		IdlePolicy: &IdlePolicy{Timeout: time.Hour},
+	}
+	sessions := make(chan Session, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sess, err := Upgrade(w, req, UpgradeOptions{
+			HandshakeHandle: func(r *http.Request, resp *HandshakeResponse) HandshakeDecision {
+				SetHandshakeValue(r, "user", r.Header.Get("X-User"))
+				SetHandshakeTag(r, "user", r.Header.Get("X-User"))
+				SetHandshakeIdlePolicy(r, IdlePolicy{Timeout: time.Minute, CountOutbound: true})
+				return AcceptHandshake()
+			},
+			Session: conf,
+		})
+		if err != nil {
+			return
+		}
+		sessions <- sess
+		sess.DoConnect()
+	}))
+	defer ts.Close()
+	testDialSession(t, ts, http.Header{"X-User": {"u1"}})
+	var sess Session
+	select {
+	case sess = <-sessions:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upgrade timeout")
+	}
+	defer sess.DisConnect()
+	if v, ok := sess.Get("user"); !ok || v != "u1" {
+		t.Fatal("value: ", v, ok)
+	}
+	if v, ok := sess.Get("role"); !ok || v != "guest" {
+		t.Fatal("configured value: ", v, ok)
+	}
+	if tags := sess.GetTags(); tags["user"] != "u1" || tags["room"] != "r1" {
+		t.Fatal("tags: ", tags)
+	}
+	if p := sess.GetIdlePolicy(); p.Timeout != time.Minute || !p.CountOutbound {
+		t.Fatalf("idle policy: %+v", p)
+	}
+	// 共用的配置不被修改
+	if conf.Tags["user"] != "default" || len(conf.Values) != 1 || conf.IdlePolicy.Timeout != time.Hour {
+		t.Fatalf("shared config changed: %+v", conf)
+	}
+}